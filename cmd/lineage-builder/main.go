@@ -3,50 +3,97 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/Erope/LineageOS-Hetzner-Build/internal/lineage"
 )
 
 func main() {
 	cleanupFlag := flag.Bool("cleanup", false, "cleanup persisted server resources")
+	verboseFlag := flag.Bool("verbose", false, "log debug diagnostics (same as LOG_LEVEL=debug)")
+	estimateFlag := flag.Bool("estimate", false, "estimate the server cost of a run lasting -avg-duration and exit")
+	avgDurationFlag := flag.Duration("avg-duration", 4*time.Hour, "average run duration used by -estimate")
+	quietFlag := flag.Bool("quiet", false, "only log warnings and errors (same as LOG_LEVEL=warn)")
 	flag.Parse()
 
-	log.Printf("lineage builder starting")
+	if err := lineage.ConfigureLogging(os.Getenv("LOG_FORMAT")); err != nil {
+		slog.Error("configuration error", "error", err)
+		os.Exit(1)
+	}
+	level := os.Getenv("LOG_LEVEL")
+	switch {
+	case *verboseFlag:
+		level = "debug"
+	case *quietFlag:
+		level = "warn"
+	}
+	if err := lineage.SetLogLevel(level); err != nil {
+		slog.Error("configuration error", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("lineage builder starting")
 
 	// Handle cleanup mode first, before full config validation
 	if *cleanupFlag {
-		log.Printf("running in cleanup mode")
+		slog.Info("running in cleanup mode")
 		cfg := lineage.Config{
 			HetznerToken:    os.Getenv("HETZNER_TOKEN"),
 			ServerStatePath: lineage.EnvOrDefault("SERVER_STATE_PATH", ".hetzner-server-state.json"),
 		}
 
 		if cfg.HetznerToken == "" {
-			log.Printf("configuration error: HETZNER_TOKEN is required")
+			slog.Error("configuration error: HETZNER_TOKEN is required")
 			os.Exit(1)
 		}
 
 		if err := lineage.CleanupPersistedServer(context.Background(), cfg); err != nil {
-			log.Printf("cleanup failed: %v", err)
+			slog.Error("cleanup failed", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("cleanup completed successfully")
+		return
+	}
+
+	if *estimateFlag {
+		cfg := lineage.Config{
+			HetznerToken:   os.Getenv("HETZNER_TOKEN"),
+			ServerType:     lineage.EnvOrDefault("HETZNER_SERVER_TYPE", "cpx62"),
+			ServerLocation: os.Getenv("HETZNER_SERVER_LOCATION"),
+		}
+		if cfg.HetznerToken == "" {
+			slog.Error("configuration error: HETZNER_TOKEN is required")
 			os.Exit(1)
 		}
-		log.Printf("cleanup completed successfully")
+		reports, err := lineage.EstimateCost(context.Background(), cfg, *avgDurationFlag)
+		if err != nil {
+			slog.Error("cost estimation failed", "error", err)
+			os.Exit(1)
+		}
+		for _, report := range reports {
+			fmt.Printf("%s\t%s\t%s\n", report.ServerType, report.Location, report)
+		}
 		return
 	}
 
 	cfg, err := lineage.LoadConfigFromEnv()
 	if err != nil {
-		log.Printf("configuration error: %v", err)
+		slog.Error("configuration error", "error", err)
 		os.Exit(1)
 	}
 
-	log.Printf("configuration loaded for source directory %s", cfg.BuildSourceDir)
+	if cfg.BuildSource != "" {
+		slog.Info("configuration loaded", "source", lineage.RedactSourceURL(cfg.BuildSource), "ref", cfg.BuildSourceRef)
+	} else {
+		slog.Info("configuration loaded", "source_dir", cfg.BuildSourceDir)
+	}
 	orchestrator := lineage.NewOrchestrator(cfg)
 	if err := orchestrator.Run(context.Background()); err != nil {
-		log.Printf("build failed: %v", err)
+		slog.Error("build failed", "error", err)
 		os.Exit(1)
 	}
-	log.Printf("build completed successfully")
+	slog.Info("build completed successfully")
 }
@@ -0,0 +1,112 @@
+package lineage
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Artifact collision policies decide what happens when two remote artifacts
+// map to the same local path.
+const (
+	ArtifactCollisionFail      = "fail"
+	ArtifactCollisionRename    = "rename"
+	ArtifactCollisionOverwrite = "overwrite"
+)
+
+// artifactDownload pairs a remote artifact with its path relative to the
+// local artifact directory.
+type artifactDownload struct {
+	Remote string
+	Local  string
+}
+
+func validArtifactCollisionPolicy(policy string) bool {
+	switch policy {
+	case ArtifactCollisionFail, ArtifactCollisionRename, ArtifactCollisionOverwrite:
+		return true
+	}
+	return false
+}
+
+// planArtifactDownloads maps remote artifact paths to local relative paths and
+// resolves collisions according to policy before anything is downloaded.
+// When preservePaths is set, the path relative to root (the resolved remote
+// artifact directory) is kept; otherwise only the base name is used.
+func planArtifactDownloads(root string, files []string, preservePaths bool, policy string) ([]artifactDownload, error) {
+	if !validArtifactCollisionPolicy(policy) {
+		return nil, fmt.Errorf("unknown artifact collision policy %q", policy)
+	}
+
+	root = strings.TrimSuffix(root, "/")
+	plan := make([]artifactDownload, 0, len(files))
+	sources := make(map[string][]string, len(files))
+	for _, remote := range files {
+		local := path.Base(remote)
+		if preservePaths && root != "" && strings.HasPrefix(remote, root+"/") {
+			local = path.Clean(strings.TrimPrefix(remote, root+"/"))
+		}
+		if !filepath.IsLocal(filepath.FromSlash(local)) {
+			return nil, fmt.Errorf("artifact %s resolves outside the local artifact dir", remote)
+		}
+		sources[local] = append(sources[local], remote)
+		plan = append(plan, artifactDownload{Remote: remote, Local: local})
+	}
+
+	var collisions []string
+	for local, remotes := range sources {
+		if len(remotes) > 1 {
+			collisions = append(collisions, fmt.Sprintf("%s (%s)", local, strings.Join(remotes, ", ")))
+		}
+	}
+	if len(collisions) == 0 {
+		return toLocalPaths(plan), nil
+	}
+	sort.Strings(collisions)
+
+	switch policy {
+	case ArtifactCollisionFail:
+		return nil, fmt.Errorf("artifact name collision: %s; set ARTIFACT_PRESERVE_PATHS=true or ARTIFACT_COLLISION_POLICY=rename", strings.Join(collisions, "; "))
+	case ArtifactCollisionRename:
+		used := make(map[string]bool, len(plan))
+		for _, item := range plan {
+			used[item.Local] = true
+		}
+		seen := make(map[string]bool, len(plan))
+		for i, item := range plan {
+			if !seen[item.Local] {
+				seen[item.Local] = true
+				continue
+			}
+			renamed := disambiguateArtifactName(item.Local, used)
+			used[renamed] = true
+			plan[i].Local = renamed
+		}
+	case ArtifactCollisionOverwrite:
+		slog.Warn("artifact name collision, later downloads overwrite earlier ones", "collisions", strings.Join(collisions, "; "))
+	}
+	return toLocalPaths(plan), nil
+}
+
+// disambiguateArtifactName appends a numeric suffix before the extension until
+// the name is not in used, e.g. lineage.zip -> lineage-2.zip.
+func disambiguateArtifactName(name string, used map[string]bool) string {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", stem, i, ext)
+		if !used[candidate] {
+			return candidate
+		}
+	}
+}
+
+func toLocalPaths(plan []artifactDownload) []artifactDownload {
+	for i := range plan {
+		plan[i].Local = filepath.FromSlash(plan[i].Local)
+	}
+	return plan
+}
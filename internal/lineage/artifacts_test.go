@@ -0,0 +1,56 @@
+package lineage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanArtifactDownloadsCollisions(t *testing.T) {
+	t.Parallel()
+
+	root := "/root/lineageos-build/zips"
+	files := []string{
+		root + "/onclite/lineage.zip",
+		root + "/lavender/lineage.zip",
+		root + "/boot.zip",
+	}
+
+	if _, err := planArtifactDownloads(root, files, false, ArtifactCollisionFail); err == nil || !strings.Contains(err.Error(), "lineage.zip") {
+		t.Fatalf("expected collision error mentioning lineage.zip, got %v", err)
+	}
+
+	plan, err := planArtifactDownloads(root, files, false, ArtifactCollisionRename)
+	if err != nil {
+		t.Fatalf("rename policy: %v", err)
+	}
+	expected := []string{"lineage.zip", "lineage-2.zip", "boot.zip"}
+	for i, item := range plan {
+		if item.Local != expected[i] {
+			t.Errorf("rename policy: artifact %d expected %q, got %q", i, expected[i], item.Local)
+		}
+	}
+
+	plan, err = planArtifactDownloads(root, files, true, ArtifactCollisionFail)
+	if err != nil {
+		t.Fatalf("preserve paths: %v", err)
+	}
+	expected = []string{
+		filepath.Join("onclite", "lineage.zip"),
+		filepath.Join("lavender", "lineage.zip"),
+		"boot.zip",
+	}
+	for i, item := range plan {
+		if item.Local != expected[i] {
+			t.Errorf("preserve paths: artifact %d expected %q, got %q", i, expected[i], item.Local)
+		}
+	}
+}
+
+func TestPlanArtifactDownloadsRejectsUnknownPolicy(t *testing.T) {
+	t.Parallel()
+
+	if _, err := planArtifactDownloads("/zips", []string{"/zips/a.zip"}, false, "merge"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
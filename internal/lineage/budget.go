@@ -0,0 +1,110 @@
+package lineage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// budgetTeardownMargin is kept free before the next billed hour starts so
+// logs, diagnostics and the server deletion finish inside the budget.
+const budgetTeardownMargin = 10 * time.Minute
+
+// budgetWarningThresholds are the fractions of the budget deadline at which
+// a warning is logged.
+var budgetWarningThresholds = []float64{0.5, 0.75, 0.9}
+
+const failureCategoryBudget = "budget-exceeded"
+
+// budgetExceededError is the cancellation cause of a run stopped by
+// MAX_COST_EUR.
+type budgetExceededError struct {
+	maxCost  float64
+	currency string
+	limit    time.Duration
+}
+
+func (e *budgetExceededError) Error() string {
+	return fmt.Sprintf("cost ceiling of %.2f %s reached after %s", e.maxCost, e.currency, e.limit)
+}
+
+// budgetDeadline converts maxCost into the longest server lifetime that stays
+// within it. Every started hour is billed, so only whole hours count.
+func budgetDeadline(pricing ServerPricing, maxCost float64) (time.Duration, error) {
+	if pricing.HourlyGross <= 0 {
+		return 0, fmt.Errorf("server type %s has no hourly price in %s", pricing.ServerType, pricing.Location)
+	}
+	hours := math.Floor(maxCost/pricing.HourlyGross + 1e-9)
+	if hours < 1 {
+		return 0, fmt.Errorf("MAX_COST_EUR %.2f is below the hourly price of %.4f %s", maxCost, pricing.HourlyGross, pricing.Currency)
+	}
+	return time.Duration(hours)*time.Hour - budgetTeardownMargin, nil
+}
+
+// checkBudget fails when maxCost does not cover one billed hour. Without a
+// configured location every location Hetzner may pick has to fit.
+func checkBudget(pricings []ServerPricing, maxCost float64) error {
+	if len(pricings) == 0 {
+		return fmt.Errorf("MAX_COST_EUR is set but the server price is unknown")
+	}
+	for _, pricing := range pricings {
+		if _, err := budgetDeadline(pricing, maxCost); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startBudgetGuard warns as the run approaches the deadline derived from
+// maxCost and cancels it with a budgetExceededError once reached. The
+// returned function stops the guard.
+func startBudgetGuard(pricing ServerPricing, maxCost float64, createdAt time.Time, cancel context.CancelCauseFunc) (func(), error) {
+	limit, err := budgetDeadline(pricing, maxCost)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("cost ceiling set", "max_cost", fmt.Sprintf("%.2f %s", maxCost, pricing.Currency), "deadline", limit)
+
+	stop := make(chan struct{})
+	go func() {
+		for _, threshold := range budgetWarningThresholds {
+			at := time.Duration(float64(limit) * threshold)
+			if !waitUntil(stop, createdAt.Add(at)) {
+				return
+			}
+			elapsed := time.Since(createdAt)
+			slog.Warn("approaching cost ceiling",
+				"elapsed", elapsed.Truncate(time.Second),
+				"deadline", limit,
+				"estimated_cost", estimateCost(pricing, elapsed, 0, 0).String(),
+				"max_cost", fmt.Sprintf("%.2f %s", maxCost, pricing.Currency))
+		}
+		if !waitUntil(stop, createdAt.Add(limit)) {
+			return
+		}
+		slog.Error("cost ceiling reached, cancelling the run", "max_cost", fmt.Sprintf("%.2f %s", maxCost, pricing.Currency))
+		cancel(&budgetExceededError{maxCost: maxCost, currency: pricing.Currency, limit: limit})
+	}()
+
+	var stopped bool
+	return func() {
+		if !stopped {
+			stopped = true
+			close(stop)
+		}
+	}, nil
+}
+
+// waitUntil blocks until deadline and reports false if stop was closed first.
+func waitUntil(stop <-chan struct{}, deadline time.Time) bool {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,66 @@
+package lineage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBudgetDeadline(t *testing.T) {
+	t.Parallel()
+
+	pricing := ServerPricing{ServerType: "cpx62", Location: "fsn1", Currency: "EUR", HourlyGross: 0.1}
+	limit, err := budgetDeadline(pricing, 0.35)
+	if err != nil {
+		t.Fatalf("budget deadline: %v", err)
+	}
+	if expected := 3*time.Hour - budgetTeardownMargin; limit != expected {
+		t.Errorf("expected %s, got %s", expected, limit)
+	}
+	if _, err := budgetDeadline(pricing, 0.05); err == nil {
+		t.Errorf("expected an error for a budget below one billed hour")
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	t.Parallel()
+
+	pricings := []ServerPricing{
+		{ServerType: "cpx62", Location: "fsn1", Currency: "EUR", HourlyGross: 0.1},
+		{ServerType: "cpx62", Location: "sin", Currency: "EUR", HourlyGross: 0.3},
+	}
+	if err := checkBudget(pricings[:1], 0.2); err != nil {
+		t.Errorf("expected the budget to fit, got %v", err)
+	}
+	if err := checkBudget(pricings, 0.2); err == nil {
+		t.Errorf("expected an error when one location is above the budget")
+	}
+	if err := checkBudget(nil, 0.2); err == nil {
+		t.Errorf("expected an error without pricing")
+	}
+}
+
+func TestBudgetGuardCancelsRun(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	// Created long enough ago that the one-hour budget is already used up.
+	createdAt := time.Now().Add(-time.Hour)
+	stop, err := startBudgetGuard(ServerPricing{Currency: "EUR", HourlyGross: 1}, 1, createdAt, cancel)
+	if err != nil {
+		t.Fatalf("start budget guard: %v", err)
+	}
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("budget guard did not cancel the run")
+	}
+	var budgetErr *budgetExceededError
+	if !errors.As(context.Cause(ctx), &budgetErr) {
+		t.Errorf("expected budget cause, got %v", context.Cause(ctx))
+	}
+}
@@ -2,83 +2,248 @@ package lineage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
 type BuildResult struct {
 	Artifacts []string
 	Logs      string
+	// ExitCode is the exit code of the build, -1 when it did not finish.
+	ExitCode int
 }
 
+const failureCategoryNoArtifacts = "no-artifacts"
+
+// errNoArtifacts reports a build that exited successfully without producing
+// anything matching ArtifactPattern.
+var errNoArtifacts = errors.New("build succeeded but produced no artifacts")
+
+// buildExitError reports a build that exited with a non-zero code.
+type buildExitError struct {
+	code int
+}
+
+func (e *buildExitError) Error() string {
+	return fmt.Sprintf("build exited with code %d", e.code)
+}
+
+// exitCodeMarker prefixes the line the compose up command reports the exit
+// code of the build on.
+const exitCodeMarker = "build_exit_code="
+
 type Builder struct {
 	ssh              *SSHClient
 	workDir          string
 	compose          string
 	serviceName      string
+	serviceMode      string
 	artifactDir      string
 	artifactPattern  string
 	localArtifactDir string
+	preservePaths    bool
+	collisionPolicy  string
+	artifactRoot     string
+	compression      string
+	compressionLevel int
+	docker           dockerInstaller
+	runtime          string
+	host             hostSetup
+	dataRoot         string
+	exitCode         int
+	registry         registrySettings
 	logs             []string
+	phaseLogs        []phaseLog
+	// sourceFiles are added to the root of streamed and synced sources.
+	sourceFiles map[string][]byte
 }
 
 const commandLogPrefix = ">>>"
 
+// Ways of running BUILD_SERVICE_NAME.
+const (
+	// ServiceModeUp runs the service with docker compose up.
+	ServiceModeUp = "up"
+	// ServiceModeRun runs the service with docker compose run --rm.
+	ServiceModeRun = "run"
+)
+
+// Builder log phases, written as separate files in the log bundle.
+const (
+	logPhaseHostSetup       = "host-setup"
+	logPhaseStaging         = "staging"
+	logPhaseDockerInstall   = "docker-install"
+	logPhaseComposePull     = "compose-pull"
+	logPhaseComposeUp       = "compose-up"
+	logPhaseArtifactListing = "artifact-listing"
+)
+
+// phaseLog holds the log lines captured while the builder was in one phase.
+type phaseLog struct {
+	Name  string
+	Lines []string
+}
+
+// composeStep is a remote command run as its own builder phase.
+type composeStep struct {
+	phase   string
+	command string
+}
+
 func NewBuilder(ssh *SSHClient, cfg Config) *Builder {
 	return &Builder{
 		ssh:              ssh,
 		workDir:          cfg.WorkingDir,
 		compose:          cfg.ComposeFile,
 		serviceName:      cfg.BuildServiceName,
+		serviceMode:      cfg.BuildServiceMode,
 		artifactDir:      cfg.ArtifactDir,
 		artifactPattern:  cfg.ArtifactPattern,
 		localArtifactDir: cfg.LocalArtifactDir,
+		preservePaths:    cfg.ArtifactPreservePaths,
+		collisionPolicy:  cfg.ArtifactCollisionPolicy,
+		compression:      cfg.SourceCompression,
+		compressionLevel: cfg.SourceCompressionLevel,
+		docker:           newDockerInstaller(cfg),
+		runtime:          RuntimeDocker,
+		host:             newHostSetup(cfg),
+		exitCode:         -1,
+		registry:         newRegistrySettings(cfg),
 	}
 }
 
 func (b *Builder) Run(ctx context.Context) (BuildResult, error) {
 	if err := b.runCompose(ctx); err != nil {
-		return BuildResult{Logs: b.joinLogs()}, err
+		return BuildResult{Logs: b.joinLogs(), ExitCode: b.exitCode}, err
 	}
 	artifacts, err := b.collectArtifacts(ctx)
 	if err != nil {
-		return BuildResult{Logs: b.joinLogs()}, err
+		return BuildResult{Logs: b.joinLogs(), ExitCode: b.exitCode}, err
 	}
-	return BuildResult{Artifacts: artifacts, Logs: b.joinLogs()}, nil
+	return BuildResult{Artifacts: artifacts, Logs: b.joinLogs(), ExitCode: b.exitCode}, nil
 }
 
 func (b *Builder) runCompose(ctx context.Context) error {
-	// [DIAGNOSE] compose 执行前：确认 docker-compose.yml 存在
-	b.logDiagnostic("Pre-compose: checking if compose file exists")
-	checkCmd := fmt.Sprintf("ls -la %s/%s 2>&1 || echo 'COMPOSE_FILE_NOT_FOUND'", shellQuote(b.workDir), shellQuote(b.compose))
-	stdout, stderr, _ := b.ssh.Run(ctx, checkCmd)
-	b.logs = append(b.logs, fmt.Sprintf("[DIAGNOSE] Compose file check: stdout=%s stderr=%s", stdout, stderr))
+	if err := b.provision(ctx); err != nil {
+		return err
+	}
+	for _, step := range b.buildComposeSteps() {
+		b.setPhase(step.phase)
+		if step.phase == logPhaseComposePull && debugEnabled() {
+			// [DIAGNOSE] compose 执行前：确认 docker-compose.yml 存在
+			b.logDiagnostic("Pre-compose: checking if compose file exists")
+			checkCmd := fmt.Sprintf("ls -la %s/%s 2>&1 || echo 'COMPOSE_FILE_NOT_FOUND'", shellQuote(b.workDir), shellQuote(b.compose))
+			stdout, stderr, _ := b.ssh.Run(ctx, checkCmd)
+			b.appendLog(fmt.Sprintf("[DIAGNOSE] Compose file check: stdout=%s stderr=%s", stdout, stderr))
+		}
+		if step.phase == logPhaseComposePull {
+			loggedIn, err := b.registryLogin(ctx)
+			if err != nil {
+				return err
+			}
+			if loggedIn {
+				defer b.registryLogout()
+			}
+		}
+		output, err := b.runCommandOutput(ctx, step.command)
+		if step.phase == logPhaseComposeUp {
+			if value, ok := markerValue(output, exitCodeMarker); ok {
+				if code, parseErr := strconv.Atoi(value); parseErr == nil {
+					b.exitCode = code
+				}
+			}
+			if b.exitCode > 0 {
+				return &buildExitError{code: b.exitCode}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	command := b.buildComposeCommand()
-	return b.runCommand(ctx, command)
+// buildComposeSteps returns the compose pull and compose up commands. Each
+// one runs as a separate remote command so its output can be archived per
+// phase.
+func (b *Builder) buildComposeSteps() []composeStep {
+	cd := fmt.Sprintf("cd %s", shellQuote(b.workDir))
+	pull := []string{cd}
+	if debugEnabled() {
+		// [DIAGNOSE] 进入目录后打印当前目录内容
+		pull = append(pull, "echo '[DIAGNOSE] Current directory after cd:' && pwd && ls -la")
+	}
+	pull = append(pull,
+		b.composeCommand()+" version",
+		b.registry.pullCommand(fmt.Sprintf("%s -f %s", b.composeCommand(), shellQuote(b.compose))),
+	)
+	return []composeStep{
+		{
+			phase:   logPhaseComposePull,
+			command: remoteScript(pull...),
+		},
+		{
+			phase:   logPhaseComposeUp,
+			command: remoteScript(cd, b.composeUpCommand()),
+		},
+	}
 }
 
-func (b *Builder) buildComposeCommand() string {
-	commands := []string{
-		"set -euo pipefail",
+// composeUpCommand runs the build and reports its exit code on an
+// exitCodeMarker line. Without a service name every service is started with
+// up, which exits 0 even when a container failed, so the exit codes of the
+// project's containers are inspected afterwards. With one, only that service
+// and its dependencies run, either through up --exit-code-from or run --rm,
+// and the remaining sidecars are stopped once it exits.
+func (b *Builder) composeUpCommand() string {
+	compose := fmt.Sprintf("%s -f %s", b.composeCommand(), shellQuote(b.compose))
+	// 实时打印日志并保留退出码：用 tee 输出到 stdout 同时保存到文件，pipefail 使管道的退出码为构建命令的退出码
+	lines := []string{"status=0"}
+	if b.serviceName == "" {
+		lines = append(lines,
+			fmt.Sprintf("%s up --build 2>&1 | tee /tmp/docker-compose.log || status=$?", compose),
+			fmt.Sprintf(`if [ "$status" -eq 0 ]; then
+  for id in $(%s %s || true); do
+    code=$(%s inspect --format '{{.State.ExitCode}}' "$id")
+    if [ "$code" -ne 0 ]; then
+      echo "container $(%s inspect --format '{{.Name}}' "$id") exited with code $code" >&2
+      status=$code
+      break
+    fi
+  done
+fi`, compose, b.composePSQuiet(), b.containerEngine(), b.containerEngine()),
+		)
+	} else {
+		service := shellQuote(b.serviceName)
+		build := fmt.Sprintf("%s up --build --exit-code-from %s %s", compose, service, service)
+		if b.serviceMode == ServiceModeRun {
+			build = fmt.Sprintf("%s build %s && %s run --rm -T %s", compose, service, compose, service)
+		}
+		lines = append(lines,
+			fmt.Sprintf("{ %s; } 2>&1 | tee /tmp/docker-compose.log || status=$?", build),
+			fmt.Sprintf("%s stop || true", compose),
+		)
 	}
-	commands = append(commands, dockerInstallCommand())
-	commands = append(commands, fmt.Sprintf("cd %s", shellQuote(b.workDir)))
-	// [DIAGNOSE] 进入目录后打印当前目录内容
-	commands = append(commands, "echo '[DIAGNOSE] Current directory after cd:' && pwd && ls -la")
-	commands = append(commands, "docker compose version")
-	commands = append(commands, fmt.Sprintf("docker compose -f %s pull", shellQuote(b.compose)))
-	// 实时打印日志并保留退出码：用 tee 输出到 stdout 同时保存到文件，PIPESTATUS[0] 获取 docker compose 的退出码
-	commands = append(commands, fmt.Sprintf("docker compose -f %s up --build 2>&1 | tee /tmp/docker-compose.log; exit ${PIPESTATUS[0]}", shellQuote(b.compose)))
-	return strings.Join(commands, " && ")
+	return strings.Join(append(lines, `echo "`+exitCodeMarker+`$status"`, "exit $status"), "\n")
+}
+
+// remoteScript joins commands into a single strict-mode shell command.
+func remoteScript(commands ...string) string {
+	return strings.Join(append([]string{"set -euo pipefail"}, commands...), " && ")
 }
 
 // dockerInstallCommand returns a shell script that ensures Docker and the
 // Docker Compose plugin are installed before running the build commands.
-// The script assumes a Debian/Ubuntu-based image with apt-get and root access.
+// It uses the get.docker.com installer, which supports Ubuntu, Debian and
+// Fedora, and assumes root access.
 func dockerInstallCommand() string {
 	return strings.TrimSpace(`
 install_docker_packages() {
@@ -118,11 +283,12 @@ fi`)
 }
 
 func (b *Builder) StageSource(ctx context.Context, archivePath string) error {
+	b.setPhase(logPhaseStaging)
 	// [DIAGNOSE] 上传前：打印本地 archive 信息
 	if info, err := os.Stat(archivePath); err == nil {
-		log.Printf("[DIAGNOSE] Pre-upload: local archive=%s, size=%d bytes", archivePath, info.Size())
+		slog.Debug("[DIAGNOSE] Pre-upload: local archive", "path", archivePath, "size_bytes", info.Size())
 	} else {
-		log.Printf("[DIAGNOSE] Pre-upload: failed to stat local archive=%s: %v", archivePath, err)
+		slog.Debug("[DIAGNOSE] Pre-upload: failed to stat local archive", "path", archivePath, "error", err)
 	}
 
 	file, err := os.Open(filepath.Clean(archivePath))
@@ -131,47 +297,162 @@ func (b *Builder) StageSource(ctx context.Context, archivePath string) error {
 	}
 	defer file.Close()
 
+	header := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("read source archive: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("read source archive: %w", err)
+	}
+	compression, err := b.remoteCompression(ctx, sniffCompression(header[:n]))
+	if err != nil {
+		return err
+	}
+	var upload io.Reader = file
+	if compression != sniffCompression(header[:n]) {
+		transcoder := gzipTranscoder(file)
+		defer transcoder.Close()
+		upload = transcoder
+	}
+
 	suffix, err := randomSuffix()
 	if err != nil {
 		return err
 	}
-	remoteArchive := fmt.Sprintf("/tmp/lineage-repo-%s.tar.gz", suffix)
-	if err := b.ssh.Upload(ctx, remoteArchive, file, 0o600); err != nil {
+	remoteArchive := fmt.Sprintf("/tmp/lineage-repo-%s%s", suffix, archiveExtension(compression))
+	if err := b.ssh.Upload(ctx, remoteArchive, upload, 0o600); err != nil {
 		return fmt.Errorf("upload source archive: %w", err)
 	}
 
-	// [DIAGNOSE] 上传后：确认远程文件存在
-	b.logDiagnostic("Post-upload: verifying remote archive exists")
-	verifyCmd := fmt.Sprintf("ls -la %s", remoteArchive)
-	stdout, stderr, _ := b.ssh.Run(ctx, verifyCmd)
-	b.logs = append(b.logs, fmt.Sprintf("[DIAGNOSE] Remote archive verification: stdout=%s stderr=%s", stdout, stderr))
+	if debugEnabled() {
+		// [DIAGNOSE] 上传后：确认远程文件存在
+		b.logDiagnostic("Post-upload: verifying remote archive exists")
+		verifyCmd := fmt.Sprintf("ls -la %s", remoteArchive)
+		stdout, stderr, _ := b.ssh.Run(ctx, verifyCmd)
+		b.appendLog(fmt.Sprintf("[DIAGNOSE] Remote archive verification: stdout=%s stderr=%s", stdout, stderr))
+	}
 
-	commands := []string{
-		"set -euo pipefail",
+	command := remoteScript(
 		fmt.Sprintf("rm -rf %s", shellQuote(b.workDir)),
 		fmt.Sprintf("mkdir -p %s", shellQuote(b.workDir)),
-		fmt.Sprintf("tar -xzf %s -C %s", shellQuote(remoteArchive), shellQuote(b.workDir)),
+		detectingExtractCommand(remoteArchive, b.workDir),
 		fmt.Sprintf("rm -f %s", shellQuote(remoteArchive)),
+	)
+	return b.runCommand(ctx, command+" && "+b.stagedSummaryCommand())
+}
+
+// StreamSource pipes the source directory as a tar stream over the SSH session
+// straight into tar -x in the working directory, without writing an archive
+// on either side. The server hashes the stream it received and the result
+// is compared with the local hash.
+func (b *Builder) StreamSource(ctx context.Context, sourceDir string, matcher *excludeMatcher) error {
+	b.setPhase(logPhaseStaging)
+	if err := b.runCommand(ctx, remoteScript(fmt.Sprintf("rm -rf %s", shellQuote(b.workDir)))); err != nil {
+		return err
+	}
+	if err := b.streamSourceTar(ctx, sourceDir, matcher, nil); err != nil {
+		return err
+	}
+	return b.runCommand(ctx, remoteScript(b.stagedSummaryCommand()))
+}
+
+// streamSourceTar pipes sourceDir, or the part selected by include, as a
+// compressed tar stream into tar -x in the working directory and compares
+// the checksum of the stream on both ends.
+func (b *Builder) streamSourceTar(ctx context.Context, sourceDir string, matcher *excludeMatcher, include func(rel string, isDir bool) bool) error {
+	compression, err := b.remoteCompression(ctx, b.compression)
+	if err != nil {
+		return err
+	}
+	level := b.compressionLevel
+	if compression != b.compression {
+		level = 0
+	}
+	reader, writer := io.Pipe()
+	hasher := sha256.New()
+	compressor, err := newCompressWriter(io.MultiWriter(writer, hasher), compression, level)
+	if err != nil {
+		return err
+	}
+	var stats sourceArchiveStats
+	go func() {
+		var err error
+		stats, err = writeSourceTar(ctx, sourceDir, compressor, matcher, include, b.sourceFiles)
+		if err == nil {
+			err = compressor.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	command := remoteScript(
+		fmt.Sprintf("mkdir -p %s", shellQuote(b.workDir)),
+		fmt.Sprintf("{ tee /dev/fd/3 | %s >&2; } 3>&1 | sha256sum", tarExtractCommand(compression, "", b.workDir)),
+	)
+	b.appendLog(fmt.Sprintf("%s %s", commandLogPrefix, command))
+	stdout, stderr, err := b.ssh.RunWithInput(ctx, command, reader)
+	b.appendLog(stdout)
+	if stderr != "" {
+		b.appendLog(stderr)
+	}
+	// Unblock the archiver if the remote side stopped reading early.
+	_ = reader.Close()
+	if err != nil {
+		return fmt.Errorf("stream source archive: %w", err)
+	}
+
+	localSum := hex.EncodeToString(hasher.Sum(nil))
+	remoteSum := parseSHA256Sum(stdout)
+	if remoteSum != localSum {
+		return fmt.Errorf("source stream checksum mismatch: local %s, remote %q", localSum, remoteSum)
 	}
-	command := strings.Join(commands, " && ")
+	slog.Info("source streamed", "files", stats.files, "uncompressed", formatBytes(stats.size), "excluded", stats.excluded, "sha256", localSum)
+	return nil
+}
 
-	// [DIAGNOSE] 解压后：打印工作目录内容
-	command += fmt.Sprintf(" && echo '[DIAGNOSE] Post-extract: listing workDir=%s' && ls -la %s", b.workDir, shellQuote(b.workDir))
-	command += fmt.Sprintf(" && echo '[DIAGNOSE] Post-extract: find all files in workDir' && (find %s -type f 2>&1 | head -50 || true)", shellQuote(b.workDir))
+// stagedSummaryCommand reports what ended up in the working directory: a
+// file count, or full listings at debug level.
+func (b *Builder) stagedSummaryCommand() string {
+	if debugEnabled() {
+		// [DIAGNOSE] 解压后：打印工作目录内容
+		return fmt.Sprintf("echo '[DIAGNOSE] Post-extract: listing workDir=%s' && ls -la %s", b.workDir, shellQuote(b.workDir)) +
+			fmt.Sprintf(" && echo '[DIAGNOSE] Post-extract: find all files in workDir' && (find %s -type f 2>&1 | head -50 || true)", shellQuote(b.workDir))
+	}
+	return fmt.Sprintf("echo \"staged $(find %s -type f | wc -l) files in %s\"", shellQuote(b.workDir), b.workDir)
+}
 
-	return b.runCommand(ctx, command)
+// parseSHA256Sum extracts the hash from sha256sum output such as
+// "<hex>  -".
+func parseSHA256Sum(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == "-" && len(fields[0]) == sha256.Size*2 {
+			return fields[0]
+		}
+	}
+	return ""
 }
 
 func (b *Builder) collectArtifacts(ctx context.Context) ([]string, error) {
-	command := fmt.Sprintf("cd %s && find %s -maxdepth 3 -type f -name %s -exec realpath {} \\;", shellQuote(b.workDir), shellQuote(b.artifactDir), shellQuote(b.artifactPattern))
+	b.setPhase(logPhaseArtifactListing)
+	// The first line is the resolved artifact directory so that downloads can
+	// keep paths relative to it.
+	command := fmt.Sprintf("cd %s && realpath %s && find %s -maxdepth 3 -type f -name %s -exec realpath {} \\;", shellQuote(b.workDir), shellQuote(b.artifactDir), shellQuote(b.artifactDir), shellQuote(b.artifactPattern))
 	stdout, _, err := b.ssh.Run(ctx, command)
-	b.logs = append(b.logs, stdout)
+	b.appendLog(stdout)
 	if err != nil {
 		return nil, fmt.Errorf("list artifacts: %w", err)
 	}
-	files := strings.Fields(strings.TrimSpace(stdout))
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	b.artifactRoot = strings.TrimSpace(lines[0])
+	files := make([]string, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
 	if len(files) == 0 {
-		return nil, fmt.Errorf("no artifacts matched %s/%s", b.artifactDir, b.artifactPattern)
+		return nil, fmt.Errorf("%w: nothing matched %s/%s", errNoArtifacts, b.artifactDir, b.artifactPattern)
 	}
 	return files, nil
 }
@@ -180,15 +461,21 @@ func (b *Builder) DownloadArtifacts(ctx context.Context, files []string) ([]stri
 	if b.localArtifactDir == "" {
 		return nil, fmt.Errorf("LOCAL_ARTIFACT_DIR is required")
 	}
+	plan, err := planArtifactDownloads(b.artifactRoot, files, b.preservePaths, b.collisionPolicy)
+	if err != nil {
+		return nil, err
+	}
 	if err := os.MkdirAll(b.localArtifactDir, 0o755); err != nil {
 		return nil, fmt.Errorf("create artifact dir: %w", err)
 	}
-	localPaths := make([]string, 0, len(files))
-	for _, remote := range files {
-		filename := filepath.Base(remote)
-		localPath := filepath.Join(b.localArtifactDir, filename)
-		if err := b.ssh.Download(ctx, remote, localPath); err != nil {
-			return nil, fmt.Errorf("download artifact %s: %w", remote, err)
+	localPaths := make([]string, 0, len(plan))
+	for _, item := range plan {
+		localPath := filepath.Join(b.localArtifactDir, item.Local)
+		if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+			return nil, fmt.Errorf("create artifact dir: %w", err)
+		}
+		if err := b.ssh.Download(ctx, item.Remote, localPath); err != nil {
+			return nil, fmt.Errorf("download artifact %s: %w", item.Remote, err)
 		}
 		localPaths = append(localPaths, localPath)
 	}
@@ -196,7 +483,7 @@ func (b *Builder) DownloadArtifacts(ctx context.Context, files []string) ([]stri
 }
 
 func (b *Builder) SaveRemoteLogs(ctx context.Context) (string, error) {
-	command := fmt.Sprintf("cd %s && docker compose -f %s logs --no-color", shellQuote(b.workDir), shellQuote(b.compose))
+	command := fmt.Sprintf("cd %s && %s -f %s logs --no-color", shellQuote(b.workDir), b.composeCommand(), shellQuote(b.compose))
 	stdout, stderr, err := b.ssh.Run(ctx, command)
 	b.logs = append(b.logs, stdout)
 	if stderr != "" {
@@ -205,10 +492,53 @@ func (b *Builder) SaveRemoteLogs(ctx context.Context) (string, error) {
 	return joinLogParts(stdout, stderr), err
 }
 
+// SaveServiceLogs returns the docker compose logs of every service defined in
+// the compose file, keyed by service name.
+func (b *Builder) SaveServiceLogs(ctx context.Context) (map[string]string, error) {
+	cd := fmt.Sprintf("cd %s", shellQuote(b.workDir))
+	stdout, _, err := b.ssh.Run(ctx, fmt.Sprintf("%s && %s -f %s config --services", cd, b.composeCommand(), shellQuote(b.compose)))
+	if err != nil {
+		return nil, fmt.Errorf("list compose services: %w", err)
+	}
+	serviceLogs := make(map[string]string)
+	for _, service := range strings.Fields(stdout) {
+		command := fmt.Sprintf("%s && %s -f %s logs --no-color %s", cd, b.composeCommand(), shellQuote(b.compose), shellQuote(service))
+		logs, stderr, err := b.ssh.Run(ctx, command)
+		if err != nil {
+			return serviceLogs, fmt.Errorf("collect logs for service %s: %w", service, err)
+		}
+		serviceLogs[service] = joinLogParts(logs, stderr)
+	}
+	return serviceLogs, nil
+}
+
 func (b *Builder) joinLogs() string {
 	return strings.Join(b.logs, "\n")
 }
 
+// reachedPhase reports whether the builder has entered the named phase.
+func (b *Builder) reachedPhase(name string) bool {
+	for _, phase := range b.phaseLogs {
+		if phase.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Builder) setPhase(name string) {
+	b.phaseLogs = append(b.phaseLogs, phaseLog{Name: name})
+}
+
+// appendLog records lines in the combined log and in the current phase log.
+func (b *Builder) appendLog(lines ...string) {
+	b.logs = append(b.logs, lines...)
+	if len(b.phaseLogs) > 0 {
+		current := &b.phaseLogs[len(b.phaseLogs)-1]
+		current.Lines = append(current.Lines, lines...)
+	}
+}
+
 // joinLogParts trims log values and joins the non-empty parts with newlines.
 // It is used across the lineage package to normalize log output and is
 // intentionally package-level for reuse.
@@ -225,21 +555,27 @@ func joinLogParts(values ...string) string {
 }
 
 func (b *Builder) runCommand(ctx context.Context, command string) error {
-	b.logs = append(b.logs, fmt.Sprintf("%s %s", commandLogPrefix, command))
+	_, err := b.runCommandOutput(ctx, command)
+	return err
+}
+
+// runCommandOutput runs command like runCommand and also returns its stdout.
+func (b *Builder) runCommandOutput(ctx context.Context, command string) (string, error) {
+	b.appendLog(fmt.Sprintf("%s %s", commandLogPrefix, command))
 	stdout, stderr, err := b.ssh.Run(ctx, command)
-	b.logs = append(b.logs, stdout)
+	b.appendLog(stdout)
 	if stderr != "" {
-		b.logs = append(b.logs, stderr)
+		b.appendLog(stderr)
 	}
 	if err != nil {
-		return fmt.Errorf("remote command failed: %w", err)
+		return stdout, fmt.Errorf("remote command failed: %w", err)
 	}
-	return nil
+	return stdout, nil
 }
 
 // [DIAGNOSE] logDiagnostic 打印诊断日志
 func (b *Builder) logDiagnostic(msg string) {
 	logMsg := fmt.Sprintf("[DIAGNOSE] %s", msg)
-	log.Printf("%s", logMsg)
-	b.logs = append(b.logs, logMsg)
+	slog.Debug(logMsg)
+	b.appendLog(logMsg)
 }
@@ -1,6 +1,10 @@
 package lineage
 
 import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -34,7 +38,11 @@ func TestRunComposeUsesDockerComposePlugin(t *testing.T) {
 		WorkingDir:  "/tmp/build",
 		ComposeFile: "docker-compose.yml",
 	})
-	composeCommand := builder.buildComposeCommand()
+	var commands []string
+	for _, step := range builder.buildComposeSteps() {
+		commands = append(commands, step.command)
+	}
+	composeCommand := strings.Join(commands, "\n")
 	expectedSnippets := []string{
 		"docker compose version",
 		"docker compose -f 'docker-compose.yml' pull",
@@ -46,3 +54,80 @@ func TestRunComposeUsesDockerComposePlugin(t *testing.T) {
 		}
 	}
 }
+
+func TestRunComposeUsesPodmanCompose(t *testing.T) {
+	t.Parallel()
+
+	builder := NewBuilder(&SSHClient{}, Config{WorkingDir: "/tmp/build", ComposeFile: "docker-compose.yml"})
+	builder.runtime = RuntimePodman
+	steps := builder.buildComposeSteps()
+	if !strings.Contains(steps[len(steps)-1].command, "podman-compose -f 'docker-compose.yml' up --build") {
+		t.Errorf("expected podman-compose, got %q", steps[len(steps)-1].command)
+	}
+}
+
+func TestComposeUpCommandTargetsService(t *testing.T) {
+	t.Parallel()
+
+	for mode, snippets := range map[string][]string{
+		ServiceModeUp:  {"up --build --exit-code-from 'build' 'build'"},
+		ServiceModeRun: {"build 'build' && docker compose -f 'docker-compose.yml' run --rm -T 'build'"},
+	} {
+		builder := NewBuilder(&SSHClient{}, Config{ComposeFile: "docker-compose.yml", BuildServiceName: "build", BuildServiceMode: mode})
+		command := builder.composeUpCommand()
+		for _, snippet := range append(snippets, "docker compose -f 'docker-compose.yml' stop", "exit $status") {
+			if !strings.Contains(command, snippet) {
+				t.Errorf("%s: expected %q in %q", mode, snippet, command)
+			}
+		}
+	}
+
+	all := NewBuilder(&SSHClient{}, Config{ComposeFile: "docker-compose.yml"}).composeUpCommand()
+	if strings.Contains(all, "--exit-code-from") || strings.Contains(all, " stop") {
+		t.Errorf("expected every service to run without a service name, got %q", all)
+	}
+}
+
+func TestComposeUpCommandReportsExitCode(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	// A stub docker whose up succeeds while one container exited with 2.
+	bin := t.TempDir()
+	stub := `#!/bin/sh
+case "$*" in
+  *" ps -a -q") echo ok; echo failed ;;
+  *"ExitCode}} failed") echo 2 ;;
+  *"ExitCode}} ok") echo 0 ;;
+  *"Name}} failed") echo /build-1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(stub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	builder := NewBuilder(&SSHClient{}, Config{ComposeFile: "docker-compose.yml"})
+	cmd := exec.Command("bash", "-c", remoteScript("cd "+shellQuote(t.TempDir()), builder.composeUpCommand()))
+	cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+		t.Fatalf("expected exit code 2, got %v", err)
+	}
+	if value, ok := markerValue(string(output), exitCodeMarker); !ok || value != "2" {
+		t.Errorf("expected the exit code marker, got %q", output)
+	}
+}
+
+func TestParseSHA256Sum(t *testing.T) {
+	t.Parallel()
+
+	sum := strings.Repeat("ab", 32)
+	if got := parseSHA256Sum("noise\n" + sum + "  -\n"); got != sum {
+		t.Errorf("expected %s, got %q", sum, got)
+	}
+	if got := parseSHA256Sum("sha256sum: command not found"); got != "" {
+		t.Errorf("expected no checksum, got %q", got)
+	}
+}
@@ -3,7 +3,7 @@ package lineage
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 )
 
 // CleanupPersistedServer attempts to cleanup a server from persisted state
@@ -14,14 +14,18 @@ func CleanupPersistedServer(ctx context.Context, cfg Config) error {
 	}
 
 	if state == nil {
-		log.Printf("no persisted server state found at %s", cfg.ServerStatePath)
+		slog.Info("no persisted server state found", "path", cfg.ServerStatePath)
 		return nil
 	}
 
-	log.Printf("found persisted server state: id=%d name=%s ip=%s", state.ServerID, state.ServerName, state.ServerIP)
-
-	hetznerClient := NewHetznerClient(cfg.HetznerToken)
+	slog.Info("found persisted server state", "server_id", state.ServerID, "name", state.ServerName, "ip", state.ServerIP)
+	return deletePersistedServer(ctx, NewHetznerClient(cfg.HetznerToken), cfg.ServerStatePath, state)
+}
 
+// deletePersistedServer deletes the server recorded in state together with
+// the SSH keys created for it, waits until it is gone and removes the state
+// file at statePath.
+func deletePersistedServer(ctx context.Context, hetznerClient *HetznerClient, statePath string, state *ServerState) error {
 	// Check if server still exists
 	exists, err := hetznerClient.ServerExists(ctx, state.ServerID)
 	if err != nil {
@@ -29,50 +33,53 @@ func CleanupPersistedServer(ctx context.Context, cfg Config) error {
 	}
 
 	if !exists {
-		log.Printf("server %d no longer exists, cleaning up state file", state.ServerID)
-		if err := DeleteServerState(cfg.ServerStatePath); err != nil {
-			log.Printf("warning: failed to delete state file: %v", err)
+		slog.Info("server no longer exists, cleaning up state file", "server_id", state.ServerID)
+		if err := DeleteServerState(statePath); err != nil {
+			slog.Warn("failed to delete state file", "error", err)
 		}
 		return nil
 	}
 
 	// Server exists, attempt to delete it
-	log.Printf("deleting server %d...", state.ServerID)
+	slog.Info("deleting server", "server_id", state.ServerID)
 	if err := hetznerClient.DeleteServer(ctx, state.ServerID); err != nil {
 		return fmt.Errorf("failed to delete server %d: %w", state.ServerID, err)
 	}
-	log.Printf("successfully deleted server %d", state.ServerID)
+	if err := hetznerClient.WaitForServerDeleted(ctx, state.ServerID); err != nil {
+		return fmt.Errorf("wait for server %d to be deleted: %w", state.ServerID, err)
+	}
+	slog.Info("successfully deleted server", "server_id", state.ServerID)
 
 	// Delete SSH key if present
 	if state.SSHKeyID != 0 {
-		log.Printf("deleting SSH key %d...", state.SSHKeyID)
+		slog.Info("deleting SSH key", "ssh_key_id", state.SSHKeyID)
 		if err := hetznerClient.DeleteSSHKey(ctx, state.SSHKeyID); err != nil {
-			log.Printf("warning: failed to delete ssh key %d: %v", state.SSHKeyID, err)
+			slog.Warn("failed to delete ssh key", "ssh_key_id", state.SSHKeyID, "error", err)
 		} else {
-			log.Printf("successfully deleted SSH key %d", state.SSHKeyID)
+			slog.Info("successfully deleted SSH key", "ssh_key_id", state.SSHKeyID)
 		}
 	}
 
 	// Delete GitHub user SSH keys if present (only those we created, not reused ones)
 	for _, keyID := range state.GitHubKeyIDs {
-		log.Printf("deleting GitHub SSH key %d...", keyID)
+		slog.Info("deleting GitHub SSH key", "ssh_key_id", keyID)
 		if err := hetznerClient.DeleteSSHKey(ctx, keyID); err != nil {
-			log.Printf("warning: failed to delete GitHub SSH key %d: %v", keyID, err)
+			slog.Warn("failed to delete GitHub SSH key", "ssh_key_id", keyID, "error", err)
 		} else {
-			log.Printf("successfully deleted GitHub SSH key %d", keyID)
+			slog.Info("successfully deleted GitHub SSH key", "ssh_key_id", keyID)
 		}
 	}
 
 	// Log reused keys but do not delete them (they may be used by other projects)
 	if len(state.GitHubKeyIDsReused) > 0 {
-		log.Printf("skipping deletion of %d reused GitHub SSH key(s) (they may be used by other projects)", len(state.GitHubKeyIDsReused))
+		slog.Info("skipping deletion of reused GitHub SSH keys (they may be used by other projects)", "count", len(state.GitHubKeyIDsReused))
 	}
 
 	// Clean up state file
-	if err := DeleteServerState(cfg.ServerStatePath); err != nil {
-		log.Printf("warning: failed to delete state file: %v", err)
+	if err := DeleteServerState(statePath); err != nil {
+		slog.Warn("failed to delete state file", "error", err)
 	} else {
-		log.Printf("cleaned up state file %s", cfg.ServerStatePath)
+		slog.Info("cleaned up state file", "path", statePath)
 	}
 
 	return nil
@@ -0,0 +1,190 @@
+package lineage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+)
+
+// Source archive compressions.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// pgzipBlockSize is the amount of input each pgzip goroutine compresses at
+// a time.
+const pgzipBlockSize = 1 << 20
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// validateCompression checks SOURCE_COMPRESSION and its level. Level 0
+// selects the default of the compressor.
+func validateCompression(compression string, level int) error {
+	switch compression {
+	case CompressionNone:
+		return nil
+	case CompressionGzip:
+		if level < 0 || level > 9 {
+			return fmt.Errorf("SOURCE_COMPRESSION_LEVEL must be between 1 and 9 for gzip, or 0 for the default")
+		}
+	case CompressionZstd:
+		if level < 0 || level > 22 {
+			return fmt.Errorf("SOURCE_COMPRESSION_LEVEL must be between 1 and 22 for zstd, or 0 for the default")
+		}
+	default:
+		return fmt.Errorf("SOURCE_COMPRESSION must be %s, %s or %s", CompressionNone, CompressionGzip, CompressionZstd)
+	}
+	return nil
+}
+
+// newCompressWriter wraps w in a compressor that uses every available CPU.
+// Closing the returned writer flushes it but leaves w open.
+func newCompressWriter(w io.Writer, compression string, level int) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		if level == 0 {
+			level = pgzip.DefaultCompression
+		}
+		gz, err := pgzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, fmt.Errorf("create gzip writer: %w", err)
+		}
+		if err := gz.SetConcurrency(pgzipBlockSize, runtime.GOMAXPROCS(0)); err != nil {
+			return nil, fmt.Errorf("configure gzip writer: %w", err)
+		}
+		return gz, nil
+	case CompressionZstd:
+		options := []zstd.EOption{zstd.WithEncoderConcurrency(runtime.GOMAXPROCS(0))}
+		if level != 0 {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		enc, err := zstd.NewWriter(w, options...)
+		if err != nil {
+			return nil, fmt.Errorf("create zstd writer: %w", err)
+		}
+		return enc, nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", compression)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// archiveExtension is the file name extension of a source archive.
+func archiveExtension(compression string) string {
+	switch compression {
+	case CompressionNone:
+		return ".tar"
+	case CompressionZstd:
+		return ".tar.zst"
+	}
+	return ".tar.gz"
+}
+
+// sniffCompression reports the compression of an archive from its magic
+// bytes.
+func sniffCompression(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+// tarExtractCommand extracts a tar stream of the given compression from
+// stdin, or from archive when it is set, into dir.
+func tarExtractCommand(compression, archive, dir string) string {
+	input := "-"
+	if archive != "" {
+		input = shellQuote(archive)
+	}
+	switch compression {
+	case CompressionGzip:
+		return fmt.Sprintf("tar -xzf %s -C %s", input, shellQuote(dir))
+	case CompressionZstd:
+		if archive != "" {
+			return fmt.Sprintf("zstd -dc %s | tar -xf - -C %s", input, shellQuote(dir))
+		}
+		return fmt.Sprintf("zstd -dc | tar -xf - -C %s", shellQuote(dir))
+	}
+	return fmt.Sprintf("tar -xf %s -C %s", input, shellQuote(dir))
+}
+
+// detectingExtractCommand extracts archive into dir with the decompressor
+// matching the magic bytes found on the server.
+func detectingExtractCommand(archive, dir string) string {
+	return fmt.Sprintf(`case "$(head -c 4 %s | od -An -tx1 | tr -d ' \n')" in 1f8b*) %s ;; 28b52ffd) %s ;; *) %s ;; esac`,
+		shellQuote(archive),
+		tarExtractCommand(CompressionGzip, archive, dir),
+		tarExtractCommand(CompressionZstd, archive, dir),
+		tarExtractCommand(CompressionNone, archive, dir))
+}
+
+// remoteHasZstd reports whether the zstd command is installed on the server.
+func (b *Builder) remoteHasZstd(ctx context.Context) (bool, error) {
+	stdout, _, err := b.ssh.Run(ctx, "command -v zstd >/dev/null 2>&1 && echo yes || echo no")
+	if err != nil {
+		return false, fmt.Errorf("check for zstd: %w", err)
+	}
+	return strings.TrimSpace(stdout) == "yes", nil
+}
+
+// remoteCompression returns the configured compression, or gzip when zstd
+// is configured but the server cannot decompress it.
+func (b *Builder) remoteCompression(ctx context.Context, compression string) (string, error) {
+	if compression != CompressionZstd {
+		return compression, nil
+	}
+	ok, err := b.remoteHasZstd(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		b.appendLog("zstd is not installed on the server, falling back to gzip")
+		return CompressionGzip, nil
+	}
+	return compression, nil
+}
+
+// gzipTranscoder re-encodes a zstd stream as gzip for servers without zstd.
+// The returned reader must be closed to stop the transcoder early.
+func gzipTranscoder(src io.Reader) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		dec, err := zstd.NewReader(bufio.NewReader(src))
+		if err != nil {
+			writer.CloseWithError(fmt.Errorf("create zstd reader: %w", err))
+			return
+		}
+		defer dec.Close()
+		gz, err := newCompressWriter(writer, CompressionGzip, 0)
+		if err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		if _, err = io.Copy(gz, dec); err == nil {
+			err = gz.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
@@ -0,0 +1,130 @@
+package lineage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestValidateCompression(t *testing.T) {
+	t.Parallel()
+
+	valid := []struct {
+		compression string
+		level       int
+	}{
+		{CompressionNone, 0},
+		{CompressionGzip, 0},
+		{CompressionGzip, 9},
+		{CompressionZstd, 19},
+	}
+	for _, tc := range valid {
+		if err := validateCompression(tc.compression, tc.level); err != nil {
+			t.Errorf("%s level %d: unexpected error %v", tc.compression, tc.level, err)
+		}
+	}
+	if err := validateCompression(CompressionGzip, 10); err == nil {
+		t.Errorf("expected gzip level 10 to be rejected")
+	}
+	if err := validateCompression("xz", 0); err == nil {
+		t.Errorf("expected unknown compression to be rejected")
+	}
+}
+
+func TestCreateRepoArchiveCompressions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte("services: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		archivePath := filepath.Join(t.TempDir(), "repo"+archiveExtension(compression))
+		if _, err := createRepoArchive(context.Background(), dir, archivePath, newExcludeMatcher(nil), compression, 0, nil); err != nil {
+			t.Fatalf("%s: create archive: %v", compression, err)
+		}
+		data, err := os.ReadFile(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sniffCompression(data); got != compression {
+			t.Errorf("%s: archive sniffed as %s", compression, got)
+		}
+
+		var reader io.Reader = bytes.NewReader(data)
+		switch compression {
+		case CompressionGzip:
+			if reader, err = gzip.NewReader(reader); err != nil {
+				t.Fatalf("gzip reader: %v", err)
+			}
+		case CompressionZstd:
+			dec, err := zstd.NewReader(reader)
+			if err != nil {
+				t.Fatalf("zstd reader: %v", err)
+			}
+			defer dec.Close()
+			reader = dec
+		}
+		header, err := tar.NewReader(reader).Next()
+		if err != nil || header.Name != "docker-compose.yml" {
+			t.Errorf("%s: unexpected first entry %v %v", compression, header, err)
+		}
+	}
+}
+
+func TestGzipTranscoder(t *testing.T) {
+	t.Parallel()
+
+	var compressed bytes.Buffer
+	enc, err := newCompressWriter(&compressed, CompressionZstd, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := strings.Repeat("lineage ", 1000)
+	if _, err := io.WriteString(enc, payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	transcoder := gzipTranscoder(&compressed)
+	defer transcoder.Close()
+	gz, err := gzip.NewReader(transcoder)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	out, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("read transcoded stream: %v", err)
+	}
+	if string(out) != payload {
+		t.Errorf("transcoded payload differs")
+	}
+}
+
+func TestTarExtractCommand(t *testing.T) {
+	t.Parallel()
+
+	if got := tarExtractCommand(CompressionZstd, "", "/root/work"); got != "zstd -dc | tar -xf - -C '/root/work'" {
+		t.Errorf("unexpected stream command %q", got)
+	}
+	got := detectingExtractCommand("/tmp/repo.tar.zst", "/root/work")
+	for _, want := range []string{
+		"1f8b*) tar -xzf '/tmp/repo.tar.zst' -C '/root/work'",
+		"28b52ffd) zstd -dc '/tmp/repo.tar.zst' | tar -xf - -C '/root/work'",
+		"*) tar -xf '/tmp/repo.tar.zst' -C '/root/work'",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %q", want, got)
+		}
+	}
+}
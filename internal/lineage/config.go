@@ -18,4 +18,94 @@ type Config struct {
 	BuildTimeoutMinutes int
 	KeepServerOnFailure bool
 	ServerStatePath     string
+	// ArtifactPreservePaths keeps artifact paths relative to ArtifactDir.
+	ArtifactPreservePaths bool
+	// ArtifactCollisionPolicy is one of fail, rename or overwrite.
+	ArtifactCollisionPolicy string
+	// MetricsListenAddr, when set, serves Prometheus metrics during the run.
+	MetricsListenAddr string
+	// PushgatewayURL, when set, receives the run metrics at the end.
+	PushgatewayURL string
+	PushgatewayJob string
+	// MaxCostEUR, when positive, cancels the run before its estimated server
+	// cost exceeds this amount.
+	MaxCostEUR float64
+	// Notification sinks. Each one is enabled once its settings are present.
+	NotifyWebhookURL        string
+	NotifyWebhookSecret     string
+	NotifyTelegramBotToken  string
+	NotifyTelegramChatID    string
+	NotifyTelegramAPIURL    string
+	NotifyMatrixHomeserver  string
+	NotifyMatrixAccessToken string
+	NotifyMatrixRoomID      string
+	NotifyDiscordWebhookURL string
+	// NotifyEvents limits notifications to a comma-separated list of events.
+	NotifyEvents string
+	// HooksFile is a JSON file of pre/post hooks run at phase boundaries.
+	HooksFile string
+	// SourceExcludes are .gitignore-style patterns left out of the source
+	// archive, in addition to those in BuildSourceDir/.lineageignore.
+	SourceExcludes []string
+	// SourceTransfer is archive (write, upload, extract), stream (pipe the
+	// archive straight into tar on the server) or sync (send only changes).
+	SourceTransfer string
+	// ReuseServer keeps the server after the run and reuses it next time.
+	ReuseServer bool
+	// SourceCompression is none, gzip or zstd; SourceCompressionLevel 0
+	// keeps the compressor default.
+	SourceCompression      string
+	SourceCompressionLevel int
+	// SecretScanPolicy is warn, fail or off. Key files below SigningKeysDir,
+	// relative to BuildSourceDir, are not reported.
+	SecretScanPolicy string
+	SigningKeysDir   string
+	// RequireCleanSource refuses to build a source directory that is not a
+	// git repository or has uncommitted changes.
+	RequireCleanSource bool
+	// BuildSource is a git URL cloned on the server instead of uploading
+	// BuildSourceDir. BuildSourceRef is a branch, tag or commit; the token
+	// authenticates HTTPS clones.
+	BuildSource      string
+	BuildSourceRef   string
+	BuildSourceToken string
+	// DockerInstallMethod is script (get.docker.com or distribution
+	// packages), repo (pinned packages from Docker's repository) or static
+	// (binaries uploaded from the runner).
+	DockerInstallMethod  string
+	DockerVersion        string
+	DockerComposeVersion string
+	DockerStaticArchive  string
+	DockerComposeBinary  string
+	// GetDockerSHA256 verifies the get.docker.com script.
+	GetDockerSHA256 string
+	// ContainerRuntime is docker, podman or auto (Docker, falling back to
+	// Podman when the install fails).
+	ContainerRuntime string
+	// SwapSizeGB is the size of the swapfile created before the build; 0
+	// creates none. Swappiness sets vm.swappiness; -1 keeps the default.
+	SwapSizeGB int
+	Swappiness int
+	// MountVolumes formats unformatted attached volumes and mounts them
+	// under /mnt.
+	MountVolumes bool
+	// DockerDataRoot is Docker's data-root on the server: empty keeps the
+	// default, auto picks the disk with the most free space.
+	DockerDataRoot string
+	// MinFreeDiskGB fails the build early when the working directory or the
+	// Docker data-root has less free space; 0 disables the check.
+	MinFreeDiskGB int
+	// BuildServiceMode is up or run and only applies with BuildServiceName.
+	BuildServiceMode string
+	// RegistryServer, RegistryUsername and RegistryPassword log the server in
+	// before pulling; an empty server means Docker Hub.
+	RegistryServer   string
+	RegistryUsername string
+	RegistryPassword string
+	// RegistryMirrors are written to registry-mirrors in daemon.json.
+	RegistryMirrors []string
+	// PullRetries is the number of compose pull attempts; the delay between
+	// them starts at PullRetryDelaySeconds and doubles.
+	PullRetries           int
+	PullRetryDelaySeconds int
 }
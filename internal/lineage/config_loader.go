@@ -2,51 +2,165 @@ package lineage
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"strconv"
+	"strings"
 )
 
 const (
-	defaultServerType     = "cpx62"
-	defaultServerImage    = "ubuntu-22.04"
-	defaultServerName     = "lineageos-builder"
-	defaultComposeFile    = "docker-compose.yml"
-	defaultServiceName    = "build"
-	defaultWorkingDir     = "lineageos-build"
-	defaultSSHPort        = 22
-	defaultTimeoutMins    = 300
-	defaultArtifactDir    = "zips"
-	defaultArtifactGlob   = "*.zip"
-	defaultLocalArtifacts = "artifacts"
+	defaultServerType      = "cpx62"
+	defaultServerImage     = "ubuntu-22.04"
+	defaultServerName      = "lineageos-builder"
+	defaultComposeFile     = "docker-compose.yml"
+	defaultServiceName     = "build"
+	defaultWorkingDir      = "lineageos-build"
+	defaultSSHPort         = 22
+	defaultTimeoutMins     = 300
+	defaultArtifactDir     = "zips"
+	defaultArtifactGlob    = "*.zip"
+	defaultLocalArtifacts  = "artifacts"
 	defaultServerStatePath = ".hetzner-server-state.json"
 )
 
 func LoadConfigFromEnv() (Config, error) {
 	cfg := Config{
-		HetznerToken:        os.Getenv("HETZNER_TOKEN"),
-		ServerType:          envOrDefault("HETZNER_SERVER_TYPE", defaultServerType),
-		ServerLocation:      os.Getenv("HETZNER_SERVER_LOCATION"),
-		ServerImage:         envOrDefault("HETZNER_SERVER_IMAGE", defaultServerImage),
-		ServerName:          envOrDefault("HETZNER_SERVER_NAME", defaultServerName),
-		ServerUserDataPath:  os.Getenv("HETZNER_SERVER_USER_DATA"),
-		BuildSourceDir:      os.Getenv("BUILD_SOURCE_DIR"),
-		ComposeFile:         envOrDefault("BUILD_COMPOSE_FILE", defaultComposeFile),
-		BuildServiceName:    os.Getenv("BUILD_SERVICE_NAME"),
-		WorkingDir:          envOrDefault("BUILD_WORKDIR", defaultWorkingDir),
-		ArtifactDir:         envOrDefault("ARTIFACT_DIR", defaultArtifactDir),
-		ArtifactPattern:     envOrDefault("ARTIFACT_PATTERN", defaultArtifactGlob),
-		LocalArtifactDir:    envOrDefault("LOCAL_ARTIFACT_DIR", defaultLocalArtifacts),
-		SSHPort:             envToInt("HETZNER_SSH_PORT", defaultSSHPort),
-		BuildTimeoutMinutes: envToInt("BUILD_TIMEOUT_MINUTES", defaultTimeoutMins),
-		KeepServerOnFailure: envToBool("KEEP_SERVER_ON_FAILURE", false),
-		ServerStatePath:     envOrDefault("SERVER_STATE_PATH", defaultServerStatePath),
+		HetznerToken:            os.Getenv("HETZNER_TOKEN"),
+		ServerType:              envOrDefault("HETZNER_SERVER_TYPE", defaultServerType),
+		ServerLocation:          os.Getenv("HETZNER_SERVER_LOCATION"),
+		ServerImage:             envOrDefault("HETZNER_SERVER_IMAGE", defaultServerImage),
+		ServerName:              envOrDefault("HETZNER_SERVER_NAME", defaultServerName),
+		ServerUserDataPath:      os.Getenv("HETZNER_SERVER_USER_DATA"),
+		BuildSourceDir:          os.Getenv("BUILD_SOURCE_DIR"),
+		ComposeFile:             envOrDefault("BUILD_COMPOSE_FILE", defaultComposeFile),
+		BuildServiceName:        os.Getenv("BUILD_SERVICE_NAME"),
+		BuildServiceMode:        envOrDefault("BUILD_SERVICE_MODE", ServiceModeUp),
+		WorkingDir:              envOrDefault("BUILD_WORKDIR", defaultWorkingDir),
+		ArtifactDir:             envOrDefault("ARTIFACT_DIR", defaultArtifactDir),
+		ArtifactPattern:         envOrDefault("ARTIFACT_PATTERN", defaultArtifactGlob),
+		LocalArtifactDir:        envOrDefault("LOCAL_ARTIFACT_DIR", defaultLocalArtifacts),
+		SSHPort:                 envToInt("HETZNER_SSH_PORT", defaultSSHPort),
+		BuildTimeoutMinutes:     envToInt("BUILD_TIMEOUT_MINUTES", defaultTimeoutMins),
+		KeepServerOnFailure:     envToBool("KEEP_SERVER_ON_FAILURE", false),
+		ServerStatePath:         envOrDefault("SERVER_STATE_PATH", defaultServerStatePath),
+		ArtifactPreservePaths:   envToBool("ARTIFACT_PRESERVE_PATHS", false),
+		ArtifactCollisionPolicy: envOrDefault("ARTIFACT_COLLISION_POLICY", ArtifactCollisionFail),
+		MetricsListenAddr:       os.Getenv("METRICS_LISTEN_ADDR"),
+		PushgatewayURL:          os.Getenv("PUSHGATEWAY_URL"),
+		PushgatewayJob:          envOrDefault("PUSHGATEWAY_JOB", defaultPushgatewayJob),
+		NotifyWebhookURL:        os.Getenv("NOTIFY_WEBHOOK_URL"),
+		NotifyWebhookSecret:     os.Getenv("NOTIFY_WEBHOOK_SECRET"),
+		NotifyTelegramBotToken:  os.Getenv("NOTIFY_TELEGRAM_BOT_TOKEN"),
+		NotifyTelegramChatID:    os.Getenv("NOTIFY_TELEGRAM_CHAT_ID"),
+		NotifyTelegramAPIURL:    envOrDefault("NOTIFY_TELEGRAM_API_URL", defaultTelegramAPIURL),
+		NotifyMatrixHomeserver:  os.Getenv("NOTIFY_MATRIX_HOMESERVER"),
+		NotifyMatrixAccessToken: os.Getenv("NOTIFY_MATRIX_ACCESS_TOKEN"),
+		NotifyMatrixRoomID:      os.Getenv("NOTIFY_MATRIX_ROOM_ID"),
+		NotifyDiscordWebhookURL: os.Getenv("NOTIFY_DISCORD_WEBHOOK_URL"),
+		NotifyEvents:            os.Getenv("NOTIFY_EVENTS"),
+		HooksFile:               os.Getenv("HOOKS_FILE"),
+		SourceExcludes:          splitList(envOrDefault("SOURCE_EXCLUDES", defaultSourceExcludes)),
+		SourceTransfer:          envOrDefault("SOURCE_TRANSFER", SourceTransferArchive),
+		ReuseServer:             envToBool("REUSE_SERVER", false),
+		SourceCompression:       envOrDefault("SOURCE_COMPRESSION", CompressionGzip),
+		SecretScanPolicy:        envOrDefault("SECRET_SCAN_POLICY", SecretScanWarn),
+		SigningKeysDir:          os.Getenv("SIGNING_KEYS_DIR"),
+		RequireCleanSource:      envToBool("REQUIRE_CLEAN_SOURCE", false),
+		BuildSource:             os.Getenv("BUILD_SOURCE"),
+		BuildSourceRef:          os.Getenv("BUILD_SOURCE_REF"),
+		BuildSourceToken:        os.Getenv("BUILD_SOURCE_TOKEN"),
+		DockerInstallMethod:     envOrDefault("DOCKER_INSTALL_METHOD", DockerInstallScript),
+		DockerVersion:           envOrDefault("DOCKER_VERSION", defaultDockerVersion),
+		DockerComposeVersion:    envOrDefault("DOCKER_COMPOSE_VERSION", defaultDockerComposeVersion),
+		DockerStaticArchive:     os.Getenv("DOCKER_STATIC_ARCHIVE"),
+		DockerComposeBinary:     os.Getenv("DOCKER_COMPOSE_BINARY"),
+		GetDockerSHA256:         os.Getenv("GET_DOCKER_SHA256"),
+		ContainerRuntime:        envOrDefault("CONTAINER_RUNTIME", RuntimeDocker),
+		MountVolumes:            envToBool("MOUNT_VOLUMES", false),
+		DockerDataRoot:          os.Getenv("DOCKER_DATA_ROOT"),
+		RegistryServer:          os.Getenv("REGISTRY_SERVER"),
+		RegistryUsername:        os.Getenv("REGISTRY_USERNAME"),
+		RegistryPassword:        os.Getenv("REGISTRY_PASSWORD"),
+		RegistryMirrors:         splitList(os.Getenv("REGISTRY_MIRRORS")),
 	}
 
+	var err error
+	if cfg.MaxCostEUR, err = envToFloat("MAX_COST_EUR", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.SourceCompressionLevel, err = envToIntStrict("SOURCE_COMPRESSION_LEVEL", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.SwapSizeGB, err = envToIntStrict("SWAP_SIZE_GB", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.Swappiness, err = envToIntStrict("VM_SWAPPINESS", -1); err != nil {
+		return Config{}, err
+	}
+	if cfg.MinFreeDiskGB, err = envToIntStrict("MIN_FREE_DISK_GB", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.PullRetries, err = envToIntStrict("PULL_RETRIES", 3); err != nil {
+		return Config{}, err
+	}
+	if cfg.PullRetryDelaySeconds, err = envToIntStrict("PULL_RETRY_DELAY_SECONDS", 10); err != nil {
+		return Config{}, err
+	}
 	if cfg.HetznerToken == "" {
 		return Config{}, fmt.Errorf("HETZNER_TOKEN is required")
 	}
-	if cfg.BuildSourceDir == "" {
-		return Config{}, fmt.Errorf("BUILD_SOURCE_DIR is required")
+	if cfg.BuildSource != "" {
+		if !isGitURL(cfg.BuildSource) {
+			return Config{}, fmt.Errorf("BUILD_SOURCE must be a git URL (https://, ssh:// or user@host:path)")
+		}
+		if sourceURLHasCredentials(cfg.BuildSource) {
+			return Config{}, fmt.Errorf("BUILD_SOURCE must not contain credentials; set BUILD_SOURCE_TOKEN instead")
+		}
+		if cfg.BuildSourceToken != "" && !strings.HasPrefix(cfg.BuildSource, "https://") {
+			return Config{}, fmt.Errorf("BUILD_SOURCE_TOKEN requires an https:// BUILD_SOURCE")
+		}
+	} else if cfg.BuildSourceDir == "" {
+		return Config{}, fmt.Errorf("BUILD_SOURCE_DIR or BUILD_SOURCE is required")
+	}
+	switch cfg.BuildServiceMode {
+	case ServiceModeUp:
+	case ServiceModeRun:
+		if cfg.BuildServiceName == "" {
+			return Config{}, fmt.Errorf("BUILD_SERVICE_MODE=%s requires BUILD_SERVICE_NAME", ServiceModeRun)
+		}
+	default:
+		return Config{}, fmt.Errorf("BUILD_SERVICE_MODE must be %s or %s", ServiceModeUp, ServiceModeRun)
+	}
+	if !validArtifactCollisionPolicy(cfg.ArtifactCollisionPolicy) {
+		return Config{}, fmt.Errorf("ARTIFACT_COLLISION_POLICY must be one of %s, %s or %s", ArtifactCollisionFail, ArtifactCollisionRename, ArtifactCollisionOverwrite)
+	}
+	if cfg.MaxCostEUR < 0 {
+		return Config{}, fmt.Errorf("MAX_COST_EUR must not be negative")
+	}
+	if err := validateDockerInstall(cfg); err != nil {
+		return Config{}, err
+	}
+	if err := validateHostSetup(cfg); err != nil {
+		return Config{}, err
+	}
+	if err := validateRegistry(cfg); err != nil {
+		return Config{}, err
+	}
+	switch cfg.SecretScanPolicy {
+	case SecretScanWarn, SecretScanFail, SecretScanOff:
+	default:
+		return Config{}, fmt.Errorf("SECRET_SCAN_POLICY must be %s, %s or %s", SecretScanWarn, SecretScanFail, SecretScanOff)
+	}
+	if err := validateCompression(cfg.SourceCompression, cfg.SourceCompressionLevel); err != nil {
+		return Config{}, err
+	}
+	switch cfg.SourceTransfer {
+	case SourceTransferArchive, SourceTransferStream, SourceTransferSync:
+	default:
+		return Config{}, fmt.Errorf("SOURCE_TRANSFER must be %s, %s or %s", SourceTransferArchive, SourceTransferStream, SourceTransferSync)
+	}
+	if !validNotifyEvents(cfg.NotifyEvents) {
+		return Config{}, fmt.Errorf("NOTIFY_EVENTS must only contain %s, %s, %s or %s", EventPhase, EventSuccess, EventFailure, EventServerKeptAlive)
 	}
 
 	return cfg, nil
@@ -78,6 +192,20 @@ func envToInt(key string, fallback int) int {
 	return parsed
 }
 
+// envToIntStrict is envToInt for settings where an invalid value must fail
+// instead of silently falling back to the default.
+func envToIntStrict(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer, got %q", key, value)
+	}
+	return parsed, nil
+}
+
 func envToBool(key string, fallback bool) bool {
 	value := os.Getenv(key)
 	if value == "" {
@@ -89,3 +217,28 @@ func envToBool(key string, fallback bool) bool {
 	}
 	return parsed
 }
+
+// envToFloat parses a float setting. Unlike envToInt it rejects invalid
+// values, since a silently ignored limit is worse than a failed run.
+func envToFloat(key string, fallback float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return 0, fmt.Errorf("%s must be a number, got %q", key, value)
+	}
+	return parsed, nil
+}
+
+// splitList splits a comma-separated list and drops empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
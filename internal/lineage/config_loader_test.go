@@ -0,0 +1,53 @@
+package lineage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFromEnvSourceToken(t *testing.T) {
+	t.Setenv("HETZNER_TOKEN", "token")
+	t.Setenv("BUILD_SOURCE_TOKEN", "secret")
+
+	t.Setenv("BUILD_SOURCE", "https://github.com/org/repo.git")
+	if _, err := LoadConfigFromEnv(); err != nil {
+		t.Fatalf("unexpected error for an https:// BUILD_SOURCE: %v", err)
+	}
+
+	for _, source := range []string{
+		"http://git.example.com/org/repo.git",
+		"git@github.com:org/repo.git",
+		"ssh://git@github.com/org/repo",
+	} {
+		t.Setenv("BUILD_SOURCE", source)
+		if _, err := LoadConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "https://") {
+			t.Errorf("%s: expected BUILD_SOURCE_TOKEN to require https://, got %v", source, err)
+		}
+	}
+}
+
+func TestLoadConfigFromEnvRejectsInvalidHostSettings(t *testing.T) {
+	t.Setenv("HETZNER_TOKEN", "token")
+	t.Setenv("BUILD_SOURCE", "https://github.com/org/repo.git")
+
+	for _, key := range []string{"SWAP_SIZE_GB", "VM_SWAPPINESS", "MIN_FREE_DISK_GB"} {
+		t.Setenv(key, "200G")
+		if _, err := LoadConfigFromEnv(); err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("expected an invalid %s to be rejected, got %v", key, err)
+		}
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoadConfigFromEnvRejectsInvalidPullRetries(t *testing.T) {
+	t.Setenv("HETZNER_TOKEN", "token")
+	t.Setenv("BUILD_SOURCE", "https://github.com/org/repo.git")
+
+	for _, key := range []string{"PULL_RETRIES", "PULL_RETRY_DELAY_SECONDS"} {
+		t.Setenv(key, "3x")
+		if _, err := LoadConfigFromEnv(); err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("expected an invalid %s to be rejected, got %v", key, err)
+		}
+		t.Setenv(key, "")
+	}
+}
@@ -0,0 +1,192 @@
+package lineage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	hcloud "github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+const bytesPerTB = 1_000_000_000_000
+
+// ServerPricing is the gross price of a server type in one location.
+type ServerPricing struct {
+	ServerType      string  `json:"server_type"`
+	Location        string  `json:"location"`
+	Currency        string  `json:"currency"`
+	HourlyGross     float64 `json:"hourly_gross"`
+	MonthlyGross    float64 `json:"monthly_gross"`
+	IncludedTraffic uint64  `json:"included_traffic_bytes"`
+	PerTBTraffic    float64 `json:"per_tb_traffic_gross"`
+}
+
+// CostReport is the estimated cost of one server lifetime. Hetzner bills
+// every started hour, capped at the monthly price, and only charges traffic
+// beyond the included volume.
+type CostReport struct {
+	ServerPricing
+	ServerSeconds   float64 `json:"server_seconds"`
+	BilledHours     int     `json:"billed_hours"`
+	ServerCost      float64 `json:"server_cost"`
+	IngoingTraffic  uint64  `json:"ingoing_traffic_bytes,omitempty"`
+	OutgoingTraffic uint64  `json:"outgoing_traffic_bytes,omitempty"`
+	TrafficCost     float64 `json:"traffic_cost,omitempty"`
+	Total           float64 `json:"total"`
+	// MaxCost is the MAX_COST_EUR ceiling of the run, if any.
+	MaxCost float64 `json:"max_cost,omitempty"`
+	// ServerKeptAlive is set when the server outlived the run, so the
+	// lifetime only covers the part spent inside it.
+	ServerKeptAlive bool `json:"server_kept_alive,omitempty"`
+}
+
+// pricingFor picks the pricing of serverType in location.
+func pricingFor(serverType *hcloud.ServerType, location string) (*ServerPricing, error) {
+	for _, pricing := range serverType.Pricings {
+		if pricing.Location == nil || pricing.Location.Name != location {
+			continue
+		}
+		return newServerPricing(serverType.Name, pricing)
+	}
+	return nil, fmt.Errorf("server type %q has no pricing for location %q", serverType.Name, location)
+}
+
+func newServerPricing(serverType string, pricing hcloud.ServerTypeLocationPricing) (*ServerPricing, error) {
+	hourly, err := parsePrice(pricing.Hourly.Gross)
+	if err != nil {
+		return nil, fmt.Errorf("parse hourly price: %w", err)
+	}
+	monthly, err := parsePrice(pricing.Monthly.Gross)
+	if err != nil {
+		return nil, fmt.Errorf("parse monthly price: %w", err)
+	}
+	perTB, err := parsePrice(pricing.PerTBTraffic.Gross)
+	if err != nil {
+		return nil, fmt.Errorf("parse traffic price: %w", err)
+	}
+	return &ServerPricing{
+		ServerType:      serverType,
+		Location:        pricing.Location.Name,
+		Currency:        pricing.Hourly.Currency,
+		HourlyGross:     hourly,
+		MonthlyGross:    monthly,
+		IncludedTraffic: pricing.IncludedTraffic,
+		PerTBTraffic:    perTB,
+	}, nil
+}
+
+func parsePrice(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// estimateCost prices a server lifetime and its outgoing traffic.
+func estimateCost(pricing ServerPricing, lifetime time.Duration, ingoing, outgoing uint64) CostReport {
+	report := CostReport{
+		ServerPricing:   pricing,
+		ServerSeconds:   lifetime.Seconds(),
+		IngoingTraffic:  ingoing,
+		OutgoingTraffic: outgoing,
+	}
+	if lifetime > 0 {
+		report.BilledHours = int(math.Ceil(lifetime.Hours()))
+	}
+	report.ServerCost = float64(report.BilledHours) * pricing.HourlyGross
+	if pricing.MonthlyGross > 0 && report.ServerCost > pricing.MonthlyGross {
+		report.ServerCost = pricing.MonthlyGross
+	}
+	if outgoing > pricing.IncludedTraffic {
+		report.TrafficCost = float64(outgoing-pricing.IncludedTraffic) / bytesPerTB * pricing.PerTBTraffic
+	}
+	report.Total = report.ServerCost + report.TrafficCost
+	return report
+}
+
+// String formats the total, e.g. "0.19 EUR (4 h × 0.0476)".
+func (r CostReport) String() string {
+	return fmt.Sprintf("%.2f %s (%d h × %.4f)", r.Total, r.Currency, r.BilledHours, r.HourlyGross)
+}
+
+// ServerPricings returns the pricing of the configured server type, for the
+// configured location or for every location it is offered in.
+func (hc *HetznerClient) ServerPricings(ctx context.Context, serverTypeName, location string) ([]ServerPricing, error) {
+	serverType, _, err := hc.client.ServerType.GetByName(ctx, serverTypeName)
+	if err != nil {
+		return nil, fmt.Errorf("get server type: %w", err)
+	}
+	if serverType == nil {
+		return nil, fmt.Errorf("server type %q not found", serverTypeName)
+	}
+	if location != "" {
+		pricing, err := pricingFor(serverType, location)
+		if err != nil {
+			return nil, err
+		}
+		return []ServerPricing{*pricing}, nil
+	}
+	pricings := make([]ServerPricing, 0, len(serverType.Pricings))
+	for _, locationPricing := range serverType.Pricings {
+		if locationPricing.Location == nil {
+			continue
+		}
+		pricing, err := newServerPricing(serverType.Name, locationPricing)
+		if err != nil {
+			return nil, err
+		}
+		pricings = append(pricings, *pricing)
+	}
+	return pricings, nil
+}
+
+// ServerTraffic returns the ingoing and outgoing traffic of the server in
+// bytes as reported by Hetzner.
+func (hc *HetznerClient) ServerTraffic(ctx context.Context, id int64) (uint64, uint64, error) {
+	server, _, err := hc.client.Server.GetByID(ctx, id)
+	if err != nil {
+		return 0, 0, fmt.Errorf("get server traffic: %w", err)
+	}
+	if server == nil {
+		return 0, 0, fmt.Errorf("server %d not found", id)
+	}
+	return server.IngoingTraffic, server.OutgoingTraffic, nil
+}
+
+// EstimateCost prices a run of the given duration on the configured server
+// type, for the configured location or for every location if none is set.
+func EstimateCost(ctx context.Context, cfg Config, duration time.Duration) ([]CostReport, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	pricings, err := NewHetznerClient(cfg.HetznerToken).ServerPricings(ctx, cfg.ServerType, cfg.ServerLocation)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]CostReport, 0, len(pricings))
+	for _, pricing := range pricings {
+		reports = append(reports, estimateCost(pricing, duration, 0, 0))
+	}
+	return reports, nil
+}
+
+// recordServerCost prices the server lifetime from creation until now and
+// stores it in the run summary. Traffic is read before the server goes away.
+func (o *Orchestrator) recordServerCost(ctx context.Context, server *HetznerServer, createdAt time.Time, keptAlive bool) {
+	if server.Pricing == nil {
+		return
+	}
+	ingoing, outgoing, err := o.hetznerClient.ServerTraffic(ctx, server.ID)
+	if err != nil {
+		slog.Warn("failed to read server traffic", "error", err)
+	}
+	report := estimateCost(*server.Pricing, time.Since(createdAt), ingoing, outgoing)
+	report.ServerKeptAlive = keptAlive
+	report.MaxCost = o.cfg.MaxCostEUR
+	o.summary.Cost = &report
+	recordEstimatedCost(report.Total)
+	slog.Info("estimated server cost", "cost", report.String(), "ingoing_traffic", formatBytes(int64(ingoing)), "outgoing_traffic", formatBytes(int64(outgoing)))
+}
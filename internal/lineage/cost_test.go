@@ -0,0 +1,32 @@
+package lineage
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEstimateCost(t *testing.T) {
+	t.Parallel()
+
+	pricing := ServerPricing{
+		Currency:        "EUR",
+		HourlyGross:     0.1,
+		MonthlyGross:    50,
+		IncludedTraffic: 20 * bytesPerTB,
+		PerTBTraffic:    1,
+	}
+
+	report := estimateCost(pricing, 3*time.Hour+time.Minute, 0, 21*bytesPerTB)
+	if report.BilledHours != 4 {
+		t.Errorf("expected 4 billed hours, got %d", report.BilledHours)
+	}
+	if math.Abs(report.Total-1.4) > 1e-9 {
+		t.Errorf("expected total 1.4, got %f", report.Total)
+	}
+
+	capped := estimateCost(pricing, 1000*time.Hour, 0, 0)
+	if capped.ServerCost != pricing.MonthlyGross {
+		t.Errorf("expected cost capped at monthly price, got %f", capped.ServerCost)
+	}
+}
@@ -0,0 +1,167 @@
+package lineage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	diagnosticsArchiveName = "diagnostics.tar.gz"
+	// maxDiagnosticsFileSize bounds how much of each summary file is read back
+	// when looking for the likely cause; the full files stay in the tarball.
+	maxDiagnosticsFileSize = 1 << 20
+)
+
+// CollectDiagnostics gathers system and docker state from the server into a
+// tarball, downloads it next to build.log and returns its local path together
+// with a short description of the most likely failure cause, if one is found.
+func (b *Builder) CollectDiagnostics(ctx context.Context) (string, string, error) {
+	if b.localArtifactDir == "" {
+		return "", "", fmt.Errorf("LOCAL_ARTIFACT_DIR is required")
+	}
+	suffix, err := randomSuffix()
+	if err != nil {
+		return "", "", err
+	}
+	remoteDir := fmt.Sprintf("/tmp/lineage-diagnostics-%s", suffix)
+	remoteArchive := remoteDir + ".tar.gz"
+
+	if _, _, err := b.ssh.Run(ctx, b.diagnosticsScript(remoteDir, remoteArchive)); err != nil {
+		return "", "", fmt.Errorf("collect remote diagnostics: %w", err)
+	}
+
+	if err := os.MkdirAll(b.localArtifactDir, 0o755); err != nil {
+		return "", "", fmt.Errorf("create artifact dir: %w", err)
+	}
+	localArchive := filepath.Join(b.localArtifactDir, diagnosticsArchiveName)
+	if err := b.ssh.Download(ctx, remoteArchive, localArchive); err != nil {
+		return "", "", fmt.Errorf("download diagnostics: %w", err)
+	}
+	_, _, _ = b.ssh.Run(ctx, fmt.Sprintf("rm -f %s", shellQuote(remoteArchive)))
+
+	files, err := readDiagnosticsSummaries(localArchive)
+	if err != nil {
+		return localArchive, "", err
+	}
+	return localArchive, likelyFailureCause(files), nil
+}
+
+// diagnosticsScript returns a shell script that writes one file per probe into
+// remoteDir, copies the docker-lineage-cicd logs directory and packs
+// everything into remoteArchive. Individual probes are allowed to fail.
+// Containers are listed with the runtime the build used.
+func (b *Builder) diagnosticsScript(remoteDir, remoteArchive string) string {
+	dir := shellQuote(remoteDir)
+	workDir := shellQuote(b.workDir)
+	return strings.TrimSpace(fmt.Sprintf(`
+dir=%[1]s
+work_dir=%[2]s
+mkdir -p "$dir"
+df -h -x squashfs -x tmpfs -x devtmpfs -x overlay > "$dir/df.txt" 2>&1
+free -m > "$dir/free.txt" 2>&1
+dmesg 2>&1 | grep -iE 'out of memory|oom-kill|oom_reaper|killed process' > "$dir/dmesg-oom.txt"
+engine=%[4]s
+"$engine" ps -a > "$dir/docker-ps.txt" 2>&1
+ids=$("$engine" ps -aq 2>/dev/null)
+if [ -n "$ids" ]; then
+  "$engine" inspect --format '{{.Name}} exit_code={{.State.ExitCode}} oom_killed={{.State.OOMKilled}} error={{.State.Error}}' $ids > "$dir/docker-inspect.txt" 2>&1
+fi
+if [ -d "$work_dir/logs" ]; then
+  cp -r "$work_dir/logs" "$dir/logs"
+fi
+if [ -f /tmp/docker-compose.log ]; then
+  cp /tmp/docker-compose.log "$dir/docker-compose.log"
+fi
+grep -rhiE 'error: (cannot fetch|exited sync due to fetch errors|unable to fully sync)|fatal: unable to access|fatal: could not read|GitCommandError|error\.GitError' "$dir/logs" "$dir/docker-compose.log" 2>/dev/null | tail -n 200 > "$dir/repo-sync-errors.txt"
+grep -rhi 'no space left on device' "$dir/logs" "$dir/docker-compose.log" 2>/dev/null | tail -n 50 > "$dir/disk-errors.txt"
+tar -czf %[3]s -C "$dir" .
+status=$?
+rm -rf "$dir"
+exit $status`, dir, workDir, shellQuote(remoteArchive), shellQuote(b.containerEngine())))
+}
+
+// readDiagnosticsSummaries returns the contents of the top-level .txt files in
+// a diagnostics tarball, keyed by file name.
+func readDiagnosticsSummaries(archivePath string) (map[string]string, error) {
+	file, err := os.Open(filepath.Clean(archivePath))
+	if err != nil {
+		return nil, fmt.Errorf("open diagnostics: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("read diagnostics: %w", err)
+	}
+	defer gz.Close()
+
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read diagnostics: %w", err)
+		}
+		name := path.Clean(header.Name)
+		if header.Typeflag != tar.TypeReg || strings.Contains(name, "/") || path.Ext(name) != ".txt" {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxDiagnosticsFileSize))
+		if err != nil {
+			return nil, fmt.Errorf("read diagnostics %s: %w", name, err)
+		}
+		files[name] = string(data)
+	}
+	return files, nil
+}
+
+var (
+	oomKilledPattern = regexp.MustCompile(`(?m)^(\S+) .*oom_killed=true`)
+	fullDiskPattern  = regexp.MustCompile(`(?m)^(\S+)\s+\S+\s+\S+\s+\S+\s+100%\s+(\S+)$`)
+)
+
+// likelyFailureCause inspects the diagnostics summaries and returns a short
+// description of the most likely failure cause, or an empty string. Memory
+// exhaustion is checked first because it often shows up as secondary disk or
+// sync errors.
+func likelyFailureCause(files map[string]string) string {
+	if match := oomKilledPattern.FindStringSubmatch(files["docker-inspect.txt"]); match != nil {
+		return fmt.Sprintf("out of memory: container %s was OOM-killed", strings.TrimPrefix(match[1], "/"))
+	}
+	if line := firstNonEmptyLine(files["dmesg-oom.txt"]); line != "" {
+		return fmt.Sprintf("out of memory: kernel OOM killer fired (%s)", line)
+	}
+	// Loop devices are read-only snap images, which are always full.
+	for _, match := range fullDiskPattern.FindAllStringSubmatch(files["df.txt"], -1) {
+		if !strings.HasPrefix(match[1], "/dev/loop") {
+			return fmt.Sprintf("disk full: %s is at 100%%", match[2])
+		}
+	}
+	if line := firstNonEmptyLine(files["disk-errors.txt"]); line != "" {
+		return fmt.Sprintf("disk full: %s", line)
+	}
+	if line := firstNonEmptyLine(files["repo-sync-errors.txt"]); line != "" {
+		return fmt.Sprintf("repo sync failure: %s", line)
+	}
+	return ""
+}
+
+func firstNonEmptyLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
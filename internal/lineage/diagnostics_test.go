@@ -0,0 +1,99 @@
+package lineage
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLikelyFailureCause(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{
+			name:     "container oom killed",
+			files:    map[string]string{"docker-inspect.txt": "/lineage-build-1 exit_code=137 oom_killed=true error="},
+			expected: "out of memory: container lineage-build-1",
+		},
+		{
+			name:     "kernel oom",
+			files:    map[string]string{"dmesg-oom.txt": "[ 812.1] Out of memory: Killed process 4242 (java)"},
+			expected: "out of memory: kernel OOM killer fired",
+		},
+		{
+			name: "disk full",
+			files: map[string]string{"df.txt": `Filesystem      Size  Used Avail Use% Mounted on
+/dev/sda1       226G  226G     0 100% /`},
+			expected: "disk full: / is at 100%",
+		},
+		{
+			name: "full snap loop mount",
+			files: map[string]string{
+				"df.txt": `Filesystem      Size  Used Avail Use% Mounted on
+/dev/loop0       64M   64M     0 100% /snap/core20/2318
+/dev/sda1       226G   20G  206G   9% /`,
+				"disk-errors.txt": "write /out/target: no space left on device\n",
+			},
+			expected: "disk full: write /out/target",
+		},
+		{
+			name:     "repo sync",
+			files:    map[string]string{"repo-sync-errors.txt": "error: Cannot fetch LineageOS/android_vendor_lineage\n"},
+			expected: "repo sync failure: error: Cannot fetch",
+		},
+		{
+			name:     "nothing found",
+			files:    map[string]string{"df.txt": "/dev/sda1 226G 20G 206G 9% /"},
+			expected: "",
+		},
+	}
+	for _, tc := range cases {
+		cause := likelyFailureCause(tc.files)
+		if tc.expected == "" && cause != "" {
+			t.Errorf("%s: expected no cause, got %q", tc.name, cause)
+		}
+		if !strings.HasPrefix(cause, tc.expected) {
+			t.Errorf("%s: expected cause starting with %q, got %q", tc.name, tc.expected, cause)
+		}
+	}
+}
+
+func TestDiagnosticsScriptUsesPodman(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	bin := t.TempDir()
+	stub := `#!/bin/sh
+case "$*" in
+  "ps -aq") echo abc123 ;;
+  "ps -a") echo "abc123 build" ;;
+  inspect*) echo "build exit_code=137 oom_killed=true error=" ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "podman"), []byte(stub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	builder := NewBuilder(&SSHClient{}, Config{WorkingDir: t.TempDir(), ComposeFile: "docker-compose.yml"})
+	builder.runtime = RuntimePodman
+	archive := filepath.Join(t.TempDir(), "diagnostics.tar.gz")
+	cmd := exec.Command("bash", "-c", builder.diagnosticsScript(filepath.Join(t.TempDir(), "diag"), archive))
+	cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("diagnostics script failed: %v\n%s", err, output)
+	}
+	files, err := readDiagnosticsSummaries(archive)
+	if err != nil {
+		t.Fatalf("read diagnostics: %v", err)
+	}
+	if cause := likelyFailureCause(files); cause != "out of memory: container build was OOM-killed" {
+		t.Errorf("unexpected cause %q", cause)
+	}
+}
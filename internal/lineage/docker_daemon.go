@@ -0,0 +1,87 @@
+package lineage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// dockerDaemonConfigPath is the Docker daemon configuration on the server.
+const dockerDaemonConfigPath = "/etc/docker/daemon.json"
+
+// daemonSettings returns the daemon.json keys the build configures.
+func (b *Builder) daemonSettings() map[string]any {
+	settings := make(map[string]any)
+	if b.dataRoot != "" {
+		settings["data-root"] = b.dataRoot
+	}
+	if len(b.registry.mirrors) > 0 {
+		settings["registry-mirrors"] = b.registry.mirrors
+	}
+	return settings
+}
+
+// mergeDaemonConfig sets settings in the daemon.json document existing and
+// keeps every other key. It reports whether the document changed.
+func mergeDaemonConfig(existing string, settings map[string]any) ([]byte, bool, error) {
+	config := make(map[string]any)
+	if trimmed := bytes.TrimSpace([]byte(existing)); len(trimmed) > 0 {
+		if err := json.Unmarshal(trimmed, &config); err != nil {
+			return nil, false, fmt.Errorf("parse %s: %w", dockerDaemonConfigPath, err)
+		}
+	}
+	// Round-trip the settings so they compare equal to decoded JSON values.
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return nil, false, fmt.Errorf("encode Docker daemon settings: %w", err)
+	}
+	var normalized map[string]any
+	if err := json.Unmarshal(encoded, &normalized); err != nil {
+		return nil, false, fmt.Errorf("encode Docker daemon settings: %w", err)
+	}
+	changed := false
+	for key, value := range normalized {
+		if current, ok := config[key]; !ok || !reflect.DeepEqual(current, value) {
+			config[key] = value
+			changed = true
+		}
+	}
+	merged, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, false, fmt.Errorf("encode %s: %w", dockerDaemonConfigPath, err)
+	}
+	return append(merged, '\n'), changed, nil
+}
+
+// configureDockerDaemon merges the build's settings into daemon.json on the
+// server and restarts Docker when the file changed.
+func (b *Builder) configureDockerDaemon(ctx context.Context) error {
+	settings := b.daemonSettings()
+	if len(settings) == 0 {
+		return nil
+	}
+	if b.runtime != RuntimeDocker {
+		b.appendLog(fmt.Sprintf("%s is not used by %s; skipping Docker daemon settings", dockerDaemonConfigPath, b.runtime))
+		return nil
+	}
+	existing, err := b.runCommandOutput(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", dockerDaemonConfigPath))
+	if err != nil {
+		return err
+	}
+	merged, changed, err := mergeDaemonConfig(existing, settings)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	command := remoteScript(
+		"mkdir -p /etc/docker",
+		fmt.Sprintf("cat > %s", dockerDaemonConfigPath),
+		"systemctl restart docker",
+		"docker info --format 'Docker root dir: {{.DockerRootDir}}'",
+	)
+	return b.runCommandWithInput(ctx, command, bytes.NewReader(merged))
+}
@@ -0,0 +1,36 @@
+package lineage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMergeDaemonConfig(t *testing.T) {
+	t.Parallel()
+
+	existing := `{"log-driver": "json-file", "data-root": "/var/lib/docker"}`
+	merged, changed, err := mergeDaemonConfig(existing, map[string]any{"data-root": "/mnt/HC_Volume_1/docker"})
+	if err != nil {
+		t.Fatalf("mergeDaemonConfig: %v", err)
+	}
+	if !changed {
+		t.Errorf("expected a new data-root to change the config")
+	}
+	var config map[string]any
+	if err := json.Unmarshal(merged, &config); err != nil {
+		t.Fatalf("merged config is not JSON: %v", err)
+	}
+	if config["log-driver"] != "json-file" || config["data-root"] != "/mnt/HC_Volume_1/docker" {
+		t.Errorf("unexpected merged config %s", merged)
+	}
+
+	if _, changed, err := mergeDaemonConfig(string(merged), map[string]any{"data-root": "/mnt/HC_Volume_1/docker"}); err != nil || changed {
+		t.Errorf("expected an applied config to be unchanged, got changed=%v err=%v", changed, err)
+	}
+	if _, changed, err := mergeDaemonConfig("", map[string]any{"data-root": "/data"}); err != nil || !changed {
+		t.Errorf("expected a missing config to be created, got changed=%v err=%v", changed, err)
+	}
+	if _, _, err := mergeDaemonConfig("{not json", map[string]any{"data-root": "/data"}); err == nil {
+		t.Errorf("expected invalid JSON to be rejected")
+	}
+}
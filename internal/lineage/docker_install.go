@@ -0,0 +1,243 @@
+package lineage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Docker install methods.
+const (
+	// DockerInstallScript runs the get.docker.com convenience script where it
+	// is supported and installs unpinned packages elsewhere.
+	DockerInstallScript = "script"
+	// DockerInstallRepo configures Docker's package repository with a pinned
+	// signing key and installs pinned package versions.
+	DockerInstallRepo = "repo"
+	// DockerInstallStatic uploads static binaries from the runner.
+	DockerInstallStatic = "static"
+)
+
+const (
+	// dockerGPGFingerprint is the fingerprint of Docker's release signing key
+	// for download.docker.com.
+	dockerGPGFingerprint = "9DC858229FC7DD38854AE2D88D81803C0EBFCD88"
+
+	defaultDockerVersion        = "27.5.1"
+	defaultDockerComposeVersion = "2.32.4"
+
+	// Remote paths the static binaries are uploaded to before installing.
+	dockerStaticRemoteArchive = "/tmp/lineage-docker-static.tgz"
+	dockerStaticRemoteCompose = "/tmp/lineage-docker-compose"
+)
+
+// dockerInstaller holds the Docker install settings of a Builder.
+type dockerInstaller struct {
+	method          string
+	runtime         string
+	version         string
+	composeVersion  string
+	staticArchive   string
+	composeBinary   string
+	getDockerSHA256 string
+}
+
+func newDockerInstaller(cfg Config) dockerInstaller {
+	return dockerInstaller{
+		method:          cfg.DockerInstallMethod,
+		runtime:         cfg.ContainerRuntime,
+		version:         cfg.DockerVersion,
+		composeVersion:  cfg.DockerComposeVersion,
+		staticArchive:   cfg.DockerStaticArchive,
+		composeBinary:   cfg.DockerComposeBinary,
+		getDockerSHA256: cfg.GetDockerSHA256,
+	}
+}
+
+// validateDockerInstall checks the Docker install settings of cfg.
+func validateDockerInstall(cfg Config) error {
+	switch cfg.DockerInstallMethod {
+	case DockerInstallScript:
+	case DockerInstallRepo:
+		if cfg.DockerVersion == "" || cfg.DockerComposeVersion == "" {
+			return fmt.Errorf("DOCKER_VERSION and DOCKER_COMPOSE_VERSION are required for DOCKER_INSTALL_METHOD=%s", DockerInstallRepo)
+		}
+	case DockerInstallStatic:
+		if cfg.DockerStaticArchive == "" || cfg.DockerComposeBinary == "" {
+			return fmt.Errorf("DOCKER_STATIC_ARCHIVE and DOCKER_COMPOSE_BINARY are required for DOCKER_INSTALL_METHOD=%s", DockerInstallStatic)
+		}
+		for _, path := range []string{cfg.DockerStaticArchive, cfg.DockerComposeBinary} {
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("check static Docker binaries: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("DOCKER_INSTALL_METHOD must be %s, %s or %s", DockerInstallScript, DockerInstallRepo, DockerInstallStatic)
+	}
+	switch cfg.ContainerRuntime {
+	case RuntimeDocker, RuntimePodman, RuntimeAuto:
+	default:
+		return fmt.Errorf("CONTAINER_RUNTIME must be %s, %s or %s", RuntimeDocker, RuntimePodman, RuntimeAuto)
+	}
+	return nil
+}
+
+// environment exports the settings read by the provisioning script.
+func (d dockerInstaller) environment() string {
+	vars := [][2]string{
+		{"DOCKER_INSTALL_METHOD", d.method},
+		{"CONTAINER_RUNTIME", d.runtime},
+		{"DOCKER_VERSION", d.version},
+		{"DOCKER_COMPOSE_VERSION", d.composeVersion},
+		{"DOCKER_GPG_FINGERPRINT", dockerGPGFingerprint},
+		{"DOCKER_STATIC_ARCHIVE", dockerStaticRemoteArchive},
+		{"DOCKER_COMPOSE_BINARY", dockerStaticRemoteCompose},
+	}
+	if d.getDockerSHA256 != "" {
+		vars = append(vars, [2]string{"GET_DOCKER_SHA256", d.getDockerSHA256})
+	}
+	parts := make([]string, 0, len(vars))
+	for _, kv := range vars {
+		parts = append(parts, kv[0]+"="+shellQuote(kv[1]))
+	}
+	return "export " + strings.Join(parts, " ")
+}
+
+// upload copies the static binaries to the server. Other methods download
+// on the server and need nothing.
+func (d dockerInstaller) upload(ctx context.Context, ssh *SSHClient) error {
+	if d.method != DockerInstallStatic || d.runtime == RuntimePodman {
+		return nil
+	}
+	for local, remote := range map[string]string{
+		d.staticArchive: dockerStaticRemoteArchive,
+		d.composeBinary: dockerStaticRemoteCompose,
+	} {
+		file, err := os.Open(filepath.Clean(local))
+		if err != nil {
+			return fmt.Errorf("open %s: %w", local, err)
+		}
+		err = ssh.Upload(ctx, remote, file, 0o600)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("upload %s: %w", filepath.Base(local), err)
+		}
+	}
+	return nil
+}
+
+// dockerRepoKeyCommand downloads the signing key of Docker's repository for
+// $docker_repo to /tmp/docker.asc and aborts unless its fingerprint is
+// DOCKER_GPG_FINGERPRINT.
+const dockerRepoKeyCommand = `curl -fsSL "https://download.docker.com/linux/$docker_repo/gpg" -o /tmp/docker.asc
+fingerprints=$(gpg --show-keys --with-colons /tmp/docker.asc | awk -F: '$1 == "fpr" { print $10 }')
+if ! printf '%s\n' "$fingerprints" | grep -qx "$DOCKER_GPG_FINGERPRINT"; then
+  echo "Docker repository key fingerprint mismatch: expected $DOCKER_GPG_FINGERPRINT, got $(echo $fingerprints)" >&2
+  exit 1
+fi`
+
+// dockerAptInstallCommand installs docker-ce and the compose plugin from
+// download.docker.com on Ubuntu and Debian. The repository key is only
+// trusted when its fingerprint is DOCKER_GPG_FINGERPRINT, and DOCKER_VERSION
+// and DOCKER_COMPOSE_VERSION are resolved to exact package versions and held.
+func dockerAptInstallCommand() string {
+	return strings.TrimSpace(`
+docker_repo=$ID
+export DEBIAN_FRONTEND=noninteractive
+apt-get update -qq
+apt-get install -y -qq ca-certificates curl gnupg >/dev/null
+` + dockerRepoKeyCommand + `
+install -m 0755 -d /etc/apt/keyrings
+gpg --dearmor --yes -o /etc/apt/keyrings/docker.gpg /tmp/docker.asc
+chmod a+r /etc/apt/keyrings/docker.gpg
+rm -f /tmp/docker.asc
+echo "deb [arch=$(dpkg --print-architecture) signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/$docker_repo $VERSION_CODENAME stable" > /etc/apt/sources.list.d/docker.list
+apt-get update -qq
+apt_version() {
+  apt-cache madison "$1" | awk -v want="$2" '{ v = $3; sub(/^[0-9]+:/, "", v); if (index(v, want "-") == 1) { print $3; exit } }'
+}
+docker_version=$(apt_version docker-ce "$DOCKER_VERSION")
+compose_version=$(apt_version docker-compose-plugin "$DOCKER_COMPOSE_VERSION")
+if [ -z "$docker_version" ]; then
+  echo "docker-ce $DOCKER_VERSION is not available for $ID $VERSION_CODENAME; set DOCKER_VERSION to a published version" >&2
+  exit 1
+fi
+if [ -z "$compose_version" ]; then
+  echo "docker-compose-plugin $DOCKER_COMPOSE_VERSION is not available for $ID $VERSION_CODENAME; set DOCKER_COMPOSE_VERSION to a published version" >&2
+  exit 1
+fi
+apt-get install -y -qq "docker-ce=$docker_version" "docker-ce-cli=$docker_version" containerd.io docker-buildx-plugin "docker-compose-plugin=$compose_version"
+apt-mark hold docker-ce docker-ce-cli docker-compose-plugin >/dev/null
+systemctl enable --now docker`)
+}
+
+// dockerDnfInstallCommand installs Docker from download.docker.com on
+// Fedora and RHEL-compatible systems. Versions are pinned with the repo
+// method only.
+func dockerDnfInstallCommand() string {
+	return strings.TrimSpace(`
+case "$ID" in
+  fedora) docker_repo=fedora ;;
+  rhel) docker_repo=rhel ;;
+  *) docker_repo=centos ;;
+esac
+dnf -y -q install curl gnupg2 >/dev/null
+` + dockerRepoKeyCommand + `
+rpm --import /tmp/docker.asc
+rm -f /tmp/docker.asc
+curl -fsSL "https://download.docker.com/linux/$docker_repo/docker-ce.repo" -o /etc/yum.repos.d/docker-ce.repo
+if [ "$DOCKER_INSTALL_METHOD" = repo ]; then
+  dnf -y -q install "docker-ce-$DOCKER_VERSION" "docker-ce-cli-$DOCKER_VERSION" containerd.io docker-buildx-plugin "docker-compose-plugin-$DOCKER_COMPOSE_VERSION"
+else
+  dnf -y -q install docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin
+fi
+systemctl enable --now docker`)
+}
+
+// dockerZypperInstallCommand installs Docker and the compose plugin from the
+// openSUSE and SLES distribution repositories; Docker publishes no packages
+// for them.
+func dockerZypperInstallCommand() string {
+	return strings.TrimSpace(`
+if [ "$DOCKER_INSTALL_METHOD" = repo ]; then
+  echo "DOCKER_INSTALL_METHOD=repo is not available on $ID: Docker publishes no packages for it; use script (distribution packages) or static" >&2
+  exit 1
+fi
+zypper -n -q install docker docker-compose
+systemctl enable --now docker`)
+}
+
+// dockerStaticInstallCommand installs the uploaded static Docker archive and
+// compose plugin and runs dockerd as a systemd service.
+func dockerStaticInstallCommand() string {
+	return strings.TrimSpace(`
+tar -xzf "$DOCKER_STATIC_ARCHIVE" -C /usr/local/bin --strip-components=1
+install -D -m 0755 "$DOCKER_COMPOSE_BINARY" /usr/local/lib/docker/cli-plugins/docker-compose
+rm -f "$DOCKER_STATIC_ARCHIVE" "$DOCKER_COMPOSE_BINARY"
+cat > /etc/systemd/system/docker.service <<'UNIT'
+[Unit]
+Description=Docker Engine (static binaries)
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=/usr/local/bin/dockerd
+Restart=always
+Delegate=yes
+KillMode=process
+LimitNOFILE=infinity
+TasksMax=infinity
+
+[Install]
+WantedBy=multi-user.target
+UNIT
+systemctl daemon-reload
+systemctl enable --now docker
+for _ in $(seq 1 30); do
+  docker info >/dev/null 2>&1 && break
+  sleep 1
+done
+docker info >/dev/null`)
+}
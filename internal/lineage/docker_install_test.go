@@ -0,0 +1,113 @@
+package lineage
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDockerInstallerEnvironment(t *testing.T) {
+	t.Parallel()
+
+	env := newDockerInstaller(Config{DockerInstallMethod: DockerInstallRepo, DockerVersion: "27.5.1", ContainerRuntime: RuntimeAuto, GetDockerSHA256: "abc"}).environment()
+	for _, snippet := range []string{
+		"DOCKER_INSTALL_METHOD='repo'",
+		"CONTAINER_RUNTIME='auto'",
+		"DOCKER_VERSION='27.5.1'",
+		"DOCKER_GPG_FINGERPRINT='" + dockerGPGFingerprint + "'",
+		"GET_DOCKER_SHA256='abc'",
+	} {
+		if !strings.Contains(env, snippet) {
+			t.Errorf("expected environment to contain %q, got %q", snippet, env)
+		}
+	}
+}
+
+func TestDockerInstallCommands(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		command  string
+		snippets []string
+	}{
+		"apt":    {dockerAptInstallCommand(), []string{"gpg --show-keys --with-colons", `"docker-ce=$docker_version"`, `"docker-compose-plugin=$compose_version"`, "apt-mark hold"}},
+		"dnf":    {dockerDnfInstallCommand(), []string{"gpg --show-keys --with-colons", "rpm --import", "docker-ce.repo", `"docker-ce-$DOCKER_VERSION"`}},
+		"zypper": {dockerZypperInstallCommand(), []string{"zypper -n -q install docker docker-compose"}},
+		"static": {dockerStaticInstallCommand(), []string{`"$DOCKER_STATIC_ARCHIVE"`, "/usr/local/lib/docker/cli-plugins/docker-compose"}},
+		"podman": {podmanInstallCommand(), []string{"epel-release", "podman podman-compose"}},
+	} {
+		for _, snippet := range tc.snippets {
+			if !strings.Contains(tc.command, snippet) {
+				t.Errorf("expected %s install command to contain %q", name, snippet)
+			}
+		}
+		if name != "static" && strings.Contains(tc.command, "get.docker.com") {
+			t.Errorf("%s install command must not use get.docker.com", name)
+		}
+	}
+}
+
+func TestProvisionCommandParses(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	for _, method := range []string{DockerInstallScript, DockerInstallRepo, DockerInstallStatic} {
+		command := dockerInstaller{method: method, runtime: RuntimeAuto, version: "1", composeVersion: "2"}.provisionCommand()
+		if output, err := exec.Command("bash", "-n", "-c", command).CombinedOutput(); err != nil {
+			t.Errorf("%s provision command does not parse: %v\n%s", method, err, output)
+		}
+	}
+	command := provisionScript()
+	for _, snippet := range []string{"rocky|almalinux|centos|rhel) family=rhel", "unsupported server OS", "falling back to Podman"} {
+		if !strings.Contains(command, snippet) {
+			t.Errorf("expected provision script to contain %q", snippet)
+		}
+	}
+}
+
+func TestParseRuntime(t *testing.T) {
+	t.Parallel()
+
+	if runtime, err := parseRuntime("detected Fedora\nruntime=docker\nruntime=podman\n"); err != nil || runtime != RuntimePodman {
+		t.Errorf("parseRuntime = %q, %v", runtime, err)
+	}
+	if _, err := parseRuntime("docker compose version 2.32.4\n"); err == nil {
+		t.Errorf("expected missing runtime to be rejected")
+	}
+	if _, err := parseRuntime("runtime=lxc\n"); err == nil {
+		t.Errorf("expected unknown runtime to be rejected")
+	}
+}
+
+func TestValidateDockerInstall(t *testing.T) {
+	t.Parallel()
+
+	if err := validateDockerInstall(Config{DockerInstallMethod: "snap"}); err == nil {
+		t.Errorf("expected an unknown method to be rejected")
+	}
+	if err := validateDockerInstall(Config{DockerInstallMethod: DockerInstallRepo}); err == nil {
+		t.Errorf("expected repo without versions to be rejected")
+	}
+	if err := validateDockerInstall(Config{DockerInstallMethod: DockerInstallStatic, DockerStaticArchive: "/nonexistent.tgz", DockerComposeBinary: "/nonexistent"}); err == nil {
+		t.Errorf("expected missing static binaries to be rejected")
+	}
+
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "docker.tgz")
+	compose := filepath.Join(dir, "docker-compose")
+	for _, path := range []string{archive, compose} {
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := validateDockerInstall(Config{DockerInstallMethod: DockerInstallStatic, DockerStaticArchive: archive, DockerComposeBinary: compose, ContainerRuntime: RuntimeDocker}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := validateDockerInstall(Config{DockerInstallMethod: DockerInstallScript, ContainerRuntime: "lxc"}); err == nil {
+		t.Errorf("expected an unknown runtime to be rejected")
+	}
+}
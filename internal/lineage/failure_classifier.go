@@ -0,0 +1,104 @@
+package lineage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FailureReason is a short structured explanation of why a build failed,
+// derived from the captured build output.
+type FailureReason struct {
+	Category string `json:"category"`
+	Summary  string `json:"summary"`
+	Evidence string `json:"evidence,omitempty"`
+}
+
+func (r FailureReason) String() string {
+	if r.Evidence == "" {
+		return r.Summary
+	}
+	return fmt.Sprintf("%s: %s", r.Summary, r.Evidence)
+}
+
+type failureSignature struct {
+	category string
+	summary  string
+	patterns []*regexp.Regexp
+}
+
+// maxFailureEvidenceLength keeps the evidence short enough for an error
+// message and a summary table cell.
+const maxFailureEvidenceLength = 200
+
+// failureSignatures are checked in order. Root causes come before generic
+// symptoms: a Java heap OOM or a full disk also makes a ninja target fail, so
+// "FAILED:" is only reported when nothing more specific matched.
+var failureSignatures = []failureSignature{
+	{
+		category: "disk-full",
+		summary:  "out of disk space",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)no space left on device`),
+			regexp.MustCompile(`(?i)disk quota exceeded`),
+		},
+	},
+	{
+		category: "java-heap-oom",
+		summary:  "Java heap out of memory",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`java\.lang\.OutOfMemoryError`),
+			regexp.MustCompile(`(?i)java heap space`),
+			regexp.MustCompile(`(?i)GC overhead limit exceeded`),
+		},
+	},
+	{
+		category: "repo-sync",
+		summary:  "repo sync failed",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)error: exited sync due to fetch errors`),
+			regexp.MustCompile(`(?i)error: cannot fetch \S+`),
+			regexp.MustCompile(`(?i)error: unable to fully sync the tree`),
+			regexp.MustCompile(`(?i)fatal: unable to access '[^']+'`),
+		},
+	},
+	{
+		category: "missing-vendor-blobs",
+		summary:  "missing vendor blobs",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`'vendor/[^']+', needed by '[^']+', missing and no known rule to make it`),
+			regexp.MustCompile(`No rule to make target ['` + "`" + `]?vendor/\S+`),
+			regexp.MustCompile(`vendor/\S+-vendor\.mk: No such file or directory`),
+		},
+	},
+	{
+		category: "ninja-failed",
+		summary:  "ninja target failed",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`FAILED: \S.*`),
+		},
+	},
+}
+
+// classifyBuildFailure scans build output for known LineageOS, soong and ninja
+// failure signatures and returns the first match by priority, or nil.
+func classifyBuildFailure(output string) *FailureReason {
+	for _, signature := range failureSignatures {
+		for _, pattern := range signature.patterns {
+			evidence := pattern.FindString(output)
+			if evidence == "" {
+				continue
+			}
+			evidence = strings.TrimSpace(evidence)
+			if len(evidence) > maxFailureEvidenceLength {
+				evidence = evidence[:maxFailureEvidenceLength] + "..."
+			}
+			return &FailureReason{
+				Category: signature.category,
+				Summary:  signature.summary,
+				Evidence: evidence,
+			}
+		}
+	}
+	return nil
+}
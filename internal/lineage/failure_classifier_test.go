@@ -0,0 +1,47 @@
+package lineage
+
+import "testing"
+
+func TestClassifyBuildFailure(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		output   string
+		expected string
+	}{
+		{
+			output:   "build-1  | ninja: error: 'vendor/xiaomi/onclite/proprietary/lib/libfoo.so', needed by 'out/target/product/onclite/vendor/lib/libfoo.so', missing and no known rule to make it",
+			expected: "missing-vendor-blobs",
+		},
+		{
+			output:   "build-1  | FAILED: out/soong/.intermediates/frameworks/base/framework/android_common/turbine/framework.jar",
+			expected: "ninja-failed",
+		},
+		{
+			output:   "build-1  | FAILED: out/target/common/obj/JAVA_LIBRARIES/framework_intermediates/classes.jar\nbuild-1  | java.lang.OutOfMemoryError: Java heap space",
+			expected: "java-heap-oom",
+		},
+		{
+			output:   "build-1  | error: Cannot fetch LineageOS/android_packages_apps_Trebuchet from https://github.com/LineageOS/android_packages_apps_Trebuchet",
+			expected: "repo-sync",
+		},
+		{
+			output:   "build-1  | cp: error writing 'out/target/product/onclite/system.img': No space left on device",
+			expected: "disk-full",
+		},
+	}
+	for _, tc := range cases {
+		reason := classifyBuildFailure(tc.output)
+		if reason == nil {
+			t.Errorf("expected %s for %q, got no reason", tc.expected, tc.output)
+			continue
+		}
+		if reason.Category != tc.expected {
+			t.Errorf("expected %s for %q, got %s", tc.expected, tc.output, reason.Category)
+		}
+	}
+
+	if reason := classifyBuildFailure("build-1  | #### build completed successfully ####"); reason != nil {
+		t.Errorf("expected no reason for successful output, got %v", reason)
+	}
+}
@@ -0,0 +1,119 @@
+package lineage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// actionsReporter emits GitHub Actions workflow commands: log groups, error
+// annotations, secret masks, step outputs and the step summary. Every method
+// is a no-op unless the process runs inside GitHub Actions.
+type actionsReporter struct {
+	enabled     bool
+	out         io.Writer
+	outputPath  string
+	summaryPath string
+	groupOpen   bool
+}
+
+func newActionsReporter() *actionsReporter {
+	return &actionsReporter{
+		enabled:     os.Getenv("GITHUB_ACTIONS") == "true",
+		out:         os.Stdout,
+		outputPath:  os.Getenv("GITHUB_OUTPUT"),
+		summaryPath: os.Getenv("GITHUB_STEP_SUMMARY"),
+	}
+}
+
+// StartGroup closes any open group and starts a collapsible log group.
+func (a *actionsReporter) StartGroup(title string) {
+	if !a.enabled {
+		return
+	}
+	a.EndGroup()
+	fmt.Fprintf(a.out, "::group::%s\n", escapeWorkflowData(title))
+	a.groupOpen = true
+}
+
+// EndGroup closes the open log group, if any.
+func (a *actionsReporter) EndGroup() {
+	if !a.enabled || !a.groupOpen {
+		return
+	}
+	fmt.Fprintln(a.out, "::endgroup::")
+	a.groupOpen = false
+}
+
+// Error emits an error annotation. Groups are closed first so the annotation
+// is visible without expanding a group.
+func (a *actionsReporter) Error(title, message string) {
+	if !a.enabled {
+		return
+	}
+	a.EndGroup()
+	fmt.Fprintf(a.out, "::error title=%s::%s\n", escapeWorkflowProperty(title), escapeWorkflowData(message))
+}
+
+// Mask registers a secret so the runner redacts it from all later output.
+// Multi-line values are masked line by line.
+func (a *actionsReporter) Mask(secret string) {
+	if !a.enabled {
+		return
+	}
+	for _, line := range strings.Split(secret, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fmt.Fprintf(a.out, "::add-mask::%s\n", line)
+		}
+	}
+}
+
+// SetOutput appends a step output to $GITHUB_OUTPUT. Values may span lines.
+func (a *actionsReporter) SetOutput(name, value string) error {
+	if !a.enabled || a.outputPath == "" {
+		return nil
+	}
+	delimiter, err := randomSuffix()
+	if err != nil {
+		return err
+	}
+	delimiter = "ghadelimiter_" + delimiter
+	entry := fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
+	return appendToFile(a.outputPath, entry)
+}
+
+// WriteStepSummary appends Markdown to $GITHUB_STEP_SUMMARY.
+func (a *actionsReporter) WriteStepSummary(markdown string) error {
+	if !a.enabled || a.summaryPath == "" {
+		return nil
+	}
+	return appendToFile(a.summaryPath, markdown)
+}
+
+func appendToFile(path, content string) error {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// escapeWorkflowData escapes the message part of a workflow command.
+func escapeWorkflowData(value string) string {
+	value = strings.ReplaceAll(value, "%", "%25")
+	value = strings.ReplaceAll(value, "\r", "%0D")
+	return strings.ReplaceAll(value, "\n", "%0A")
+}
+
+// escapeWorkflowProperty escapes a property value of a workflow command.
+func escapeWorkflowProperty(value string) string {
+	value = escapeWorkflowData(value)
+	value = strings.ReplaceAll(value, ":", "%3A")
+	return strings.ReplaceAll(value, ",", "%2C")
+}
@@ -0,0 +1,53 @@
+package lineage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestActionsReporterCommands(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	outputPath := filepath.Join(t.TempDir(), "output")
+	reporter := &actionsReporter{enabled: true, out: &out, outputPath: outputPath}
+
+	reporter.StartGroup("1/7 prepare source archive")
+	reporter.Mask("secret-token")
+	reporter.Error("LineageOS build failed", "build failed: 50% done\nexit 1")
+
+	expected := "::group::1/7 prepare source archive\n" +
+		"::add-mask::secret-token\n" +
+		"::endgroup::\n" +
+		"::error title=LineageOS build failed::build failed: 50%25 done%0Aexit 1\n"
+	if out.String() != expected {
+		t.Fatalf("unexpected workflow commands:\n%s", out.String())
+	}
+
+	if err := reporter.SetOutput("artifacts", "a.zip\nb.zip"); err != nil {
+		t.Fatalf("set output: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("read output file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "artifacts<<") || lines[1] != "a.zip" || lines[2] != "b.zip" || lines[3] != strings.TrimPrefix(lines[0], "artifacts<<") {
+		t.Fatalf("unexpected output file content:\n%s", data)
+	}
+}
+
+func TestActionsReporterDisabled(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	reporter := &actionsReporter{out: &out}
+	reporter.StartGroup("build")
+	reporter.Error("failed", "boom")
+	if out.Len() != 0 {
+		t.Fatalf("expected no output outside GitHub Actions, got %q", out.String())
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"crypto/md5"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
@@ -29,6 +29,11 @@ type HetznerServer struct {
 	GitHubKeyIDs       []int64
 	GitHubKeyIDsReused []int64 // Keys that were found and reused, not created
 	Datacenter         string
+	Location           string
+	// Pricing is nil when the server type has no price for the location.
+	Pricing *ServerPricing
+	// Created is when Hetzner created the server and started billing it.
+	Created time.Time
 }
 
 func NewHetznerClient(token string) *HetznerClient {
@@ -76,7 +81,7 @@ func (hc *HetznerClient) findOrCreateSSHKey(ctx context.Context, name, publicKey
 			return nil, false, fmt.Errorf("key exists but could not be found by fingerprint")
 		}
 
-		log.Printf("SSH key already exists in Hetzner (fingerprint: %s), reusing it", fingerprint)
+		slog.Info("SSH key already exists in Hetzner, reusing it", "fingerprint", fingerprint)
 		return existingKey, true, nil
 	}
 
@@ -133,9 +138,9 @@ func (hc *HetznerClient) CreateServer(ctx context.Context, cfg Config) (*Hetzner
 	// Try to fetch and inject GitHub user SSH keys if in GitHub Actions
 	githubKeys, err := GetGitHubActorSSHKeys(ctx)
 	if err != nil {
-		log.Printf("warning: %v", err)
+		slog.Warn("skipping GitHub user SSH keys", "error", err)
 	} else if len(githubKeys) > 0 {
-		log.Printf("found %d SSH key(s) from GitHub user, injecting into server for debugging", len(githubKeys))
+		slog.Info("found SSH keys from GitHub user, injecting into server for debugging", "count", len(githubKeys))
 		for i, key := range githubKeys {
 			// Note: Hetzner enforces uniqueness of SSH keys based on the public key
 			// content, not on the key name. This timestamp-based name provides a
@@ -145,7 +150,7 @@ func (hc *HetznerClient) CreateServer(ctx context.Context, cfg Config) (*Hetzner
 			ghKeyName := fmt.Sprintf("github-user-key-%d-%d", time.Now().Unix(), i)
 			ghKey, reused, err := hc.findOrCreateSSHKey(ctx, ghKeyName, key)
 			if err != nil {
-				log.Printf("warning: failed to add GitHub SSH key %d: %v", i, err)
+				slog.Warn("failed to add GitHub SSH key", "index", i, "error", err)
 				continue
 			}
 			sshKeys = append(sshKeys, ghKey)
@@ -187,6 +192,15 @@ func (hc *HetznerClient) CreateServer(ctx context.Context, cfg Config) (*Hetzner
 		return nil, fmt.Errorf("server has no public IPv4")
 	}
 
+	locationName := cfg.ServerLocation
+	if server.Datacenter != nil && server.Datacenter.Location != nil {
+		locationName = server.Datacenter.Location.Name
+	}
+	pricing, err := pricingFor(serverType, locationName)
+	if err != nil {
+		slog.Warn("cost estimation disabled", "error", err)
+	}
+
 	return &HetznerServer{
 		ID:                 server.ID,
 		Name:               server.Name,
@@ -198,9 +212,84 @@ func (hc *HetznerClient) CreateServer(ctx context.Context, cfg Config) (*Hetzner
 		GitHubKeyIDs:       githubKeyIDs,
 		GitHubKeyIDsReused: githubKeyIDsReused,
 		Datacenter:         server.Datacenter.Name,
+		Location:           locationName,
+		Pricing:            pricing,
+		Created:            server.Created,
 	}, nil
 }
 
+// ReusableServer looks up the server recorded in state. It returns nil and
+// an empty reason when the server no longer exists, and nil with the reason
+// when the server exists but is not running or does not match cfg.
+func (hc *HetznerClient) ReusableServer(ctx context.Context, state *ServerState, cfg Config) (*HetznerServer, string, error) {
+	server, _, err := hc.client.Server.GetByID(ctx, state.ServerID)
+	if err != nil {
+		return nil, "", fmt.Errorf("get server: %w", err)
+	}
+	if server == nil {
+		return nil, "", nil
+	}
+	if server.Status != hcloud.ServerStatusRunning {
+		return nil, fmt.Sprintf("status is %s", server.Status), nil
+	}
+	if server.PublicNet.IPv4.IsUnspecified() {
+		return nil, "server has no public IPv4", nil
+	}
+
+	reused := &HetznerServer{
+		ID:                 server.ID,
+		Name:               server.Name,
+		IP:                 server.PublicNet.IPv4.IP.String(),
+		SSHUser:            "root",
+		SSHKey:             []byte(state.SSHPrivateKey),
+		SSHPort:            state.SSHPort,
+		SSHKeyID:           state.SSHKeyID,
+		GitHubKeyIDs:       state.GitHubKeyIDs,
+		GitHubKeyIDsReused: state.GitHubKeyIDsReused,
+		Created:            server.Created,
+	}
+	if server.Datacenter != nil {
+		reused.Datacenter = server.Datacenter.Name
+		if server.Datacenter.Location != nil {
+			reused.Location = server.Datacenter.Location.Name
+		}
+	}
+	var serverType, image string
+	if server.ServerType != nil {
+		serverType = server.ServerType.Name
+	}
+	if server.Image != nil {
+		image = server.Image.Name
+	}
+	if reason := reuseMismatch(cfg, serverType, reused.Location, image, state.SSHPort); reason != "" {
+		return nil, reason, nil
+	}
+	if server.ServerType != nil {
+		pricing, err := pricingFor(server.ServerType, reused.Location)
+		if err != nil {
+			slog.Warn("cost estimation disabled", "error", err)
+		}
+		reused.Pricing = pricing
+	}
+	return reused, "", nil
+}
+
+// reuseMismatch reports why a persisted server with the given properties
+// cannot be reused for cfg, or "" when it can.
+func reuseMismatch(cfg Config, serverType, location, image string, sshPort int) string {
+	switch {
+	case serverType != cfg.ServerType:
+		return fmt.Sprintf("server type is %q, not %q", serverType, cfg.ServerType)
+	case cfg.ServerLocation != "" && location != cfg.ServerLocation:
+		return fmt.Sprintf("location is %q, not %q", location, cfg.ServerLocation)
+	case image != cfg.ServerImage:
+		return fmt.Sprintf("image is %q, not %q", image, cfg.ServerImage)
+	case sshPort != cfg.SSHPort:
+		return fmt.Sprintf("SSH port is %d, not %d", sshPort, cfg.SSHPort)
+	}
+	return ""
+}
+
 func (hc *HetznerClient) DeleteServer(ctx context.Context, id int64) error {
 	_, err := hc.client.Server.Delete(ctx, &hcloud.Server{ID: id})
 	if err != nil {
@@ -232,6 +321,23 @@ func (hc *HetznerClient) DeleteSSHKey(ctx context.Context, id int64) error {
 	return nil
 }
 
+// WaitForServerDeleted polls until the server no longer exists, so its name
+// can be used for a new server.
+func (hc *HetznerClient) WaitForServerDeleted(ctx context.Context, serverID int64) error {
+	for {
+		exists, err := hc.ServerExists(ctx, serverID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return nil
+		}
+		if err := sleepWithContext(ctx, 2*time.Second); err != nil {
+			return err
+		}
+	}
+}
+
 func (hc *HetznerClient) WaitForServer(ctx context.Context, serverID int64) error {
 	for {
 		server, _, err := hc.client.Server.GetByID(ctx, serverID)
@@ -0,0 +1,113 @@
+package lineage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	hcloud "github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+func TestReuseMismatch(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{ServerType: "cpx62", ServerLocation: "fsn1", ServerImage: "ubuntu-22.04", SSHPort: 22}
+	if reason := reuseMismatch(cfg, "cpx62", "fsn1", "ubuntu-22.04", 22); reason != "" {
+		t.Errorf("expected a matching server, got %q", reason)
+	}
+	cases := []struct {
+		name       string
+		serverType string
+		location   string
+		image      string
+		sshPort    int
+	}{
+		{"type", "cpx52", "fsn1", "ubuntu-22.04", 22},
+		{"location", "cpx62", "nbg1", "ubuntu-22.04", 22},
+		{"image", "cpx62", "fsn1", "debian-12", 22},
+		{"ssh port", "cpx62", "fsn1", "ubuntu-22.04", 2222},
+	}
+	for _, tc := range cases {
+		if reason := reuseMismatch(cfg, tc.serverType, tc.location, tc.image, tc.sshPort); reason == "" {
+			t.Errorf("%s: expected a mismatch", tc.name)
+		}
+	}
+
+	cfg.ServerLocation = ""
+	if reason := reuseMismatch(cfg, "cpx62", "hel1", "ubuntu-22.04", 22); reason != "" {
+		t.Errorf("expected any location to match without HETZNER_SERVER_LOCATION, got %q", reason)
+	}
+}
+
+func TestReusableServerDeletesMismatchedServer(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	deleted := false
+	var requests []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/servers/42":
+			if deleted {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":{"code":"not_found","message":"server not found"}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"server":{"id":42,"name":"lineageos-builder","status":"running","created":"2026-10-18T10:00:00Z",
+				"public_net":{"ipv4":{"ip":"203.0.113.7"},"ipv6":{"ip":"2001:db8::/64"}},
+				"server_type":{"name":"cpx52"},"image":{"name":"ubuntu-22.04"},
+				"datacenter":{"name":"fsn1-dc14","location":{"name":"fsn1"}}}}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/servers/42":
+			deleted = true
+			_, _ = w.Write([]byte(`{"action":{"id":1,"command":"delete_server","status":"running"}}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/ssh_keys/7":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":"not_found","message":"unexpected request"}}`))
+		}
+	}))
+	defer api.Close()
+
+	statePath := filepath.Join(t.TempDir(), defaultServerStatePath)
+	persisted := &HetznerServer{ID: 42, Name: "lineageos-builder", IP: "203.0.113.7", SSHKey: []byte("key"), SSHPort: 22, SSHKeyID: 7}
+	if err := SaveServerState(statePath, persisted, true); err != nil {
+		t.Fatal(err)
+	}
+	o := &Orchestrator{
+		cfg: Config{ServerType: "cpx62", ServerImage: "ubuntu-22.04", SSHPort: 22, ServerStatePath: statePath},
+		hetznerClient: &HetznerClient{
+			client: hcloud.NewClient(hcloud.WithToken("token"), hcloud.WithEndpoint(api.URL)),
+		},
+	}
+
+	server, err := o.reusableServer(context.Background())
+	if err != nil {
+		t.Fatalf("reusable server: %v", err)
+	}
+	if server != nil {
+		t.Fatalf("expected the mismatched server not to be reused")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !deleted {
+		t.Errorf("expected the mismatched server to be deleted, requests: %v", requests)
+	}
+	var keyDeleted bool
+	for _, request := range requests {
+		keyDeleted = keyDeleted || request == "DELETE /ssh_keys/7"
+	}
+	if !keyDeleted {
+		t.Errorf("expected the SSH key to be deleted, requests: %v", requests)
+	}
+	if state, err := LoadServerState(statePath); err != nil || state != nil {
+		t.Errorf("expected the state file to be removed, got %+v, %v", state, err)
+	}
+}
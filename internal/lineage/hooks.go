@@ -0,0 +1,255 @@
+package lineage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hook timing relative to its phase.
+const (
+	hookPre  = "pre"
+	hookPost = "post"
+)
+
+// Where a hook runs.
+const (
+	hookLocal  = "local"
+	hookRemote = "remote"
+)
+
+// What happens when a hook fails.
+const (
+	hookFailureFail     = "fail"
+	hookFailureContinue = "continue"
+)
+
+const defaultHookTimeoutMinutes = 30
+
+// Hook is one entry of the HOOKS_FILE. Exactly one of Command and Script is
+// set; Script is a path on the runner, relative to the hooks file, and is
+// uploaded to the server for remote hooks.
+type Hook struct {
+	Name           string `json:"name"`
+	Phase          string `json:"phase"`
+	When           string `json:"when"`
+	Run            string `json:"run"`
+	Command        string `json:"command,omitempty"`
+	Script         string `json:"script,omitempty"`
+	OnFailure      string `json:"on_failure,omitempty"`
+	TimeoutMinutes int    `json:"timeout_minutes,omitempty"`
+}
+
+type hooksFile struct {
+	Hooks []Hook `json:"hooks"`
+}
+
+// remoteHookPhases are the phases during which the server is reachable.
+var remoteHookPhases = map[string]bool{
+	phaseStageSource:       true,
+	phaseBuild:             true,
+	phaseDownloadArtifacts: true,
+}
+
+var hookPhases = map[string]bool{
+	phasePrepareSource:     true,
+	phaseCreateServer:      true,
+	phaseWaitRunning:       true,
+	phaseWaitSSH:           true,
+	phaseStageSource:       true,
+	phaseBuild:             true,
+	phaseDownloadArtifacts: true,
+}
+
+// LoadHooks reads and validates the hooks file. Script paths are resolved
+// relative to the file.
+func LoadHooks(path string) ([]Hook, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read hooks file: %w", err)
+	}
+	var file hooksFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parse hooks file: %w", err)
+	}
+	baseDir := filepath.Dir(path)
+	for i := range file.Hooks {
+		hook := &file.Hooks[i]
+		if hook.Name == "" {
+			hook.Name = fmt.Sprintf("%s-%s-%d", hook.When, hook.Phase, i+1)
+		}
+		if hook.OnFailure == "" {
+			hook.OnFailure = hookFailureFail
+		}
+		if hook.TimeoutMinutes == 0 {
+			hook.TimeoutMinutes = defaultHookTimeoutMinutes
+		}
+		if err := validateHook(*hook); err != nil {
+			return nil, fmt.Errorf("hook %q: %w", hook.Name, err)
+		}
+		if hook.Script != "" && !filepath.IsAbs(hook.Script) {
+			hook.Script = filepath.Join(baseDir, hook.Script)
+		}
+	}
+	return file.Hooks, nil
+}
+
+func validateHook(hook Hook) error {
+	if !hookPhases[hook.Phase] {
+		phases := make([]string, 0, len(hookPhases))
+		for phase := range hookPhases {
+			phases = append(phases, phase)
+		}
+		sort.Strings(phases)
+		return fmt.Errorf("phase must be one of %s", strings.Join(phases, ", "))
+	}
+	if hook.When != hookPre && hook.When != hookPost {
+		return fmt.Errorf("when must be %s or %s", hookPre, hookPost)
+	}
+	switch hook.Run {
+	case hookLocal:
+	case hookRemote:
+		if !remoteHookPhases[hook.Phase] {
+			return fmt.Errorf("remote hooks need a reachable server: use phase %s, %s or %s", phaseStageSource, phaseBuild, phaseDownloadArtifacts)
+		}
+	default:
+		return fmt.Errorf("run must be %s or %s", hookLocal, hookRemote)
+	}
+	if (hook.Command == "") == (hook.Script == "") {
+		return fmt.Errorf("exactly one of command and script is required")
+	}
+	if hook.OnFailure != hookFailureFail && hook.OnFailure != hookFailureContinue {
+		return fmt.Errorf("on_failure must be %s or %s", hookFailureFail, hookFailureContinue)
+	}
+	if hook.TimeoutMinutes < 0 {
+		return fmt.Errorf("timeout_minutes must not be negative")
+	}
+	return nil
+}
+
+// runHooks runs the hooks registered for phase at the given time, in file
+// order. A failing hook stops the run unless it is marked on_failure=continue.
+func (o *Orchestrator) runHooks(ctx context.Context, when, phase string) error {
+	for _, hook := range o.hooks {
+		if hook.When != when || hook.Phase != phase {
+			continue
+		}
+		slog.Info("running hook", "hook", hook.Name, "when", when, "phase", phase, "run", hook.Run)
+		start := time.Now()
+		err := o.runHook(ctx, hook)
+		if err == nil {
+			slog.Info("hook finished", "hook", hook.Name, "duration", time.Since(start))
+			continue
+		}
+		if hook.OnFailure == hookFailureContinue {
+			slog.Warn("hook failed, continuing", "hook", hook.Name, "error", err)
+			continue
+		}
+		return fmt.Errorf("hook %q failed: %w", hook.Name, err)
+	}
+	return nil
+}
+
+func (o *Orchestrator) runHook(ctx context.Context, hook Hook) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(hook.TimeoutMinutes)*time.Minute)
+	defer cancel()
+	env := o.hookEnv(hook)
+	if hook.Run == hookRemote {
+		return o.runRemoteHook(ctx, hook, env)
+	}
+
+	var cmd *exec.Cmd
+	if hook.Script != "" {
+		cmd = exec.CommandContext(ctx, hook.Script)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	}
+	cmd.Env = os.Environ()
+	for _, kv := range env {
+		cmd.Env = append(cmd.Env, kv[0]+"="+kv[1])
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("run local hook: %w", err)
+	}
+	return nil
+}
+
+// runRemoteHook runs the hook on the server from WorkingDir with the run
+// metadata exported. Scripts are uploaded next to the working directory
+// first.
+func (o *Orchestrator) runRemoteHook(ctx context.Context, hook Hook, env [][2]string) error {
+	if o.sshClient == nil {
+		return fmt.Errorf("server is not reachable yet")
+	}
+	command := hook.Command
+	if hook.Script != "" {
+		script, err := os.Open(filepath.Clean(hook.Script))
+		if err != nil {
+			return fmt.Errorf("open hook script: %w", err)
+		}
+		defer script.Close()
+		suffix, err := randomSuffix()
+		if err != nil {
+			return err
+		}
+		remotePath := fmt.Sprintf("/tmp/lineage-hook-%s", suffix)
+		if err := o.sshClient.Upload(ctx, remotePath, script, 0o755); err != nil {
+			return fmt.Errorf("upload hook script: %w", err)
+		}
+		command = shellQuote(remotePath)
+	}
+
+	commands := []string{
+		fmt.Sprintf("mkdir -p %s", shellQuote(o.cfg.WorkingDir)),
+		fmt.Sprintf("cd %s", shellQuote(o.cfg.WorkingDir)),
+	}
+	for _, kv := range env {
+		commands = append(commands, fmt.Sprintf("export %s=%s", kv[0], shellQuote(kv[1])))
+	}
+	commands = append(commands, command)
+	if _, _, err := o.sshClient.Run(ctx, strings.Join(commands, " && ")); err != nil {
+		return fmt.Errorf("run remote hook: %w", err)
+	}
+	return nil
+}
+
+// hookEnv is the run metadata passed to hooks as LINEAGE_* variables.
+func (o *Orchestrator) hookEnv(hook Hook) [][2]string {
+	env := [][2]string{
+		{"LINEAGE_RUN_ID", o.summary.RunID},
+		{"LINEAGE_HOOK_NAME", hook.Name},
+		{"LINEAGE_HOOK_WHEN", hook.When},
+		{"LINEAGE_PHASE", hook.Phase},
+		{"LINEAGE_BUILD_SOURCE_DIR", o.cfg.BuildSourceDir},
+		{"LINEAGE_WORKDIR", o.cfg.WorkingDir},
+		{"LINEAGE_LOCAL_ARTIFACT_DIR", o.cfg.LocalArtifactDir},
+	}
+	if o.server != nil {
+		env = append(env,
+			[2]string{"LINEAGE_SERVER_ID", strconv.FormatInt(o.server.ID, 10)},
+			[2]string{"LINEAGE_SERVER_NAME", o.server.Name},
+			[2]string{"LINEAGE_SERVER_IP", o.server.IP},
+			[2]string{"LINEAGE_SSH_PORT", strconv.Itoa(o.server.SSHPort)},
+		)
+	}
+	if len(o.summary.Artifacts) > 0 {
+		env = append(env, [2]string{"LINEAGE_ARTIFACTS", strings.Join(o.summary.Artifacts, "\n")})
+	}
+	return env
+}
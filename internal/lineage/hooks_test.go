@@ -0,0 +1,80 @@
+package lineage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadHooks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hooks.json")
+	content := `{"hooks": [
+		{"phase": "stage-source", "when": "post", "run": "remote", "script": "patches/apply.sh"},
+		{"name": "mirror", "phase": "download-artifacts", "when": "post", "run": "local", "command": "true", "on_failure": "continue"}
+	]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks, err := LoadHooks(path)
+	if err != nil {
+		t.Fatalf("load hooks: %v", err)
+	}
+	if len(hooks) != 2 {
+		t.Fatalf("expected 2 hooks, got %d", len(hooks))
+	}
+	if hooks[0].Name != "post-stage-source-1" || hooks[0].OnFailure != hookFailureFail || hooks[0].TimeoutMinutes != defaultHookTimeoutMinutes {
+		t.Errorf("unexpected defaults %+v", hooks[0])
+	}
+	if hooks[0].Script != filepath.Join(dir, "patches", "apply.sh") {
+		t.Errorf("expected script relative to the hooks file, got %q", hooks[0].Script)
+	}
+}
+
+func TestLoadHooksRejectsRemoteHookWithoutServer(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "hooks.json")
+	content := `{"hooks": [{"phase": "create-server", "when": "pre", "run": "remote", "command": "true"}]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHooks(path); err == nil {
+		t.Errorf("expected an error for a remote hook before the server exists")
+	}
+}
+
+func TestRunLocalHooks(t *testing.T) {
+	t.Parallel()
+
+	output := filepath.Join(t.TempDir(), "hook.out")
+	o := &Orchestrator{
+		cfg:     Config{WorkingDir: "lineageos-build"},
+		summary: RunSummary{RunID: "run123"},
+		hooks: []Hook{
+			{Name: "advisory", Phase: phaseBuild, When: hookPost, Run: hookLocal, Command: "exit 3", OnFailure: hookFailureContinue, TimeoutMinutes: 1},
+			{Name: "record", Phase: phaseBuild, When: hookPost, Run: hookLocal, Command: `echo "$LINEAGE_RUN_ID $LINEAGE_HOOK_WHEN $LINEAGE_PHASE" > ` + shellQuote(output), OnFailure: hookFailureFail, TimeoutMinutes: 1},
+			{Name: "fatal", Phase: phaseBuild, When: hookPre, Run: hookLocal, Command: "exit 1", OnFailure: hookFailureFail, TimeoutMinutes: 1},
+		},
+	}
+
+	if err := o.runHooks(context.Background(), hookPost, phaseBuild); err != nil {
+		t.Fatalf("post hooks: %v", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("read hook output: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "run123 post build" {
+		t.Errorf("unexpected hook environment %q", got)
+	}
+
+	if err := o.runHooks(context.Background(), hookPre, phaseBuild); err == nil {
+		t.Errorf("expected the fatal hook to fail the run")
+	}
+}
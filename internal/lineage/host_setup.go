@@ -0,0 +1,181 @@
+package lineage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DockerDataRootAuto places Docker's data-root on the filesystem with the
+	// most free space.
+	DockerDataRootAuto = "auto"
+
+	// dataRootMarker prefixes the line the host setup script reports the
+	// selected Docker data-root on.
+	dataRootMarker = "data_root="
+)
+
+// hostSetup holds the swap, volume and disk settings of a Builder.
+type hostSetup struct {
+	swapSizeGB     int
+	swappiness     int
+	mountVolumes   bool
+	dockerDataRoot string
+	minFreeDiskGB  int
+}
+
+func newHostSetup(cfg Config) hostSetup {
+	return hostSetup{
+		swapSizeGB:     cfg.SwapSizeGB,
+		swappiness:     cfg.Swappiness,
+		mountVolumes:   cfg.MountVolumes,
+		dockerDataRoot: cfg.DockerDataRoot,
+		minFreeDiskGB:  cfg.MinFreeDiskGB,
+	}
+}
+
+// validateHostSetup checks the swap and disk settings of cfg.
+func validateHostSetup(cfg Config) error {
+	if cfg.SwapSizeGB < 0 {
+		return fmt.Errorf("SWAP_SIZE_GB must not be negative")
+	}
+	if cfg.Swappiness < -1 || cfg.Swappiness > 200 {
+		return fmt.Errorf("VM_SWAPPINESS must be between 0 and 200, or -1 to keep the system default")
+	}
+	if cfg.MinFreeDiskGB < 0 {
+		return fmt.Errorf("MIN_FREE_DISK_GB must not be negative")
+	}
+	if root := cfg.DockerDataRoot; root != "" && root != DockerDataRootAuto && !strings.HasPrefix(root, "/") {
+		return fmt.Errorf("DOCKER_DATA_ROOT must be %s or an absolute path", DockerDataRootAuto)
+	}
+	return nil
+}
+
+// enabled reports whether any host setting differs from the image defaults.
+func (h hostSetup) enabled() bool {
+	return h.swapSizeGB > 0 || h.swappiness >= 0 || h.mountVolumes || h.dockerDataRoot != "" || h.minFreeDiskGB > 0
+}
+
+// command returns the remote command that applies the host settings. Its
+// last output line is dataRootMarker followed by the Docker data-root, empty
+// when Docker's default is kept.
+func (h hostSetup) command(workDir string) string {
+	return remoteScript(
+		fmt.Sprintf("export SWAP_SIZE_GB=%d VM_SWAPPINESS=%d MOUNT_VOLUMES=%t DOCKER_DATA_ROOT=%s MIN_FREE_DISK_GB=%d WORK_DIR=%s",
+			h.swapSizeGB, h.swappiness, h.mountVolumes, shellQuote(h.dockerDataRoot), h.minFreeDiskGB, shellQuote(workDir)),
+		hostSetupScript(),
+	)
+}
+
+// hostSetupScript creates the swapfile, sets vm.swappiness, formats and
+// mounts attached Hetzner volumes, picks the Docker data-root and checks the
+// free disk space. Every step is idempotent so reused servers are left as
+// they are.
+func hostSetupScript() string {
+	return strings.TrimSpace(`
+if [ "$(id -u)" -ne 0 ]; then
+  echo 'root privileges are required to prepare the host; ensure the build server runs as root' >&2
+  exit 1
+fi
+if [ "$SWAP_SIZE_GB" -gt 0 ]; then
+  if swapon --show=NAME --noheadings | grep -qx /swapfile; then
+    echo '/swapfile is already active'
+  else
+    echo "creating ${SWAP_SIZE_GB} GB swapfile"
+    rm -f /swapfile
+    fallocate -l "${SWAP_SIZE_GB}G" /swapfile 2>/dev/null || dd if=/dev/zero of=/swapfile bs=1M count=$((SWAP_SIZE_GB * 1024)) status=none
+    chmod 600 /swapfile
+    mkswap /swapfile >/dev/null
+    swapon /swapfile
+    grep -q '^/swapfile ' /etc/fstab || echo '/swapfile none swap sw 0 0' >> /etc/fstab
+  fi
+fi
+if [ "$VM_SWAPPINESS" -ge 0 ]; then
+  sysctl -q -w vm.swappiness="$VM_SWAPPINESS"
+  echo "vm.swappiness = $VM_SWAPPINESS" > /etc/sysctl.d/90-lineage-swappiness.conf
+fi
+if [ "$MOUNT_VOLUMES" = true ]; then
+  for device in /dev/disk/by-id/scsi-0HC_Volume_*; do
+    [ -e "$device" ] || continue
+    mountpoint=/mnt/${device##*/scsi-0}
+    if findmnt -rn -S "$(readlink -f "$device")" >/dev/null; then
+      echo "$device is already mounted"
+      continue
+    fi
+    if ! blkid "$device" >/dev/null 2>&1; then
+      echo "formatting $device as ext4"
+      mkfs.ext4 -q -F "$device"
+    fi
+    mkdir -p "$mountpoint"
+    mount -o discard,defaults "$device" "$mountpoint"
+    grep -q "^$device " /etc/fstab || echo "$device $mountpoint auto discard,nofail,defaults 0 0" >> /etc/fstab
+    echo "mounted $device at $mountpoint"
+  done
+fi
+data_root=
+case "$DOCKER_DATA_ROOT" in
+  '') ;;
+  auto)
+    mount=$(df -P -k -x tmpfs -x devtmpfs -x overlay -x squashfs | awk 'NR > 1 && $6 !~ /^\/boot/ && $4 > max { max = $4; mount = $6 } END { print mount }')
+    if [ -z "$mount" ] || [ "$mount" = / ]; then
+      data_root=/var/lib/docker
+    else
+      data_root=$mount/docker
+    fi
+    ;;
+  *) data_root=$DOCKER_DATA_ROOT ;;
+esac
+if [ -n "$data_root" ]; then
+  mkdir -p "$data_root"
+fi
+check_free() {
+  dir=$1
+  while [ ! -d "$dir" ]; do
+    dir=$(dirname "$dir")
+  done
+  avail=$(df -P -k "$dir" | awk 'NR == 2 { print $4 }')
+  mount=$(df -P -k "$dir" | awk 'NR == 2 { print $6 }')
+  if [ "$avail" -lt $((MIN_FREE_DISK_GB * 1024 * 1024)) ]; then
+    echo "not enough free disk space for $1: $((avail / 1024 / 1024)) GB available on $mount, MIN_FREE_DISK_GB is $MIN_FREE_DISK_GB; choose a larger server type, attach a volume or free up space" >&2
+    exit 1
+  fi
+  echo "$1: $((avail / 1024 / 1024)) GB free on $mount"
+}
+if [ "$MIN_FREE_DISK_GB" -gt 0 ]; then
+  check_free "$WORK_DIR"
+  check_free "${data_root:-/var/lib/docker}"
+fi
+echo "` + dataRootMarker + `$data_root"`)
+}
+
+// markerValue returns the value of the last output line starting with
+// marker, and whether there was one.
+func markerValue(output, marker string) (string, bool) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); strings.HasPrefix(line, marker) {
+			return strings.TrimPrefix(line, marker), true
+		}
+	}
+	return "", false
+}
+
+// PrepareHost applies the swap, volume and disk settings before the source
+// is staged, so a server without enough disk space fails before the upload.
+func (b *Builder) PrepareHost(ctx context.Context) error {
+	if !b.host.enabled() {
+		return nil
+	}
+	b.setPhase(logPhaseHostSetup)
+	output, err := b.runCommandOutput(ctx, b.host.command(b.workDir))
+	if err != nil {
+		return fmt.Errorf("prepare host: %w", err)
+	}
+	dataRoot, ok := markerValue(output, dataRootMarker)
+	if !ok {
+		return fmt.Errorf("prepare host: script did not report the Docker data-root")
+	}
+	b.dataRoot = dataRoot
+	return nil
+}
@@ -0,0 +1,68 @@
+package lineage
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestHostSetupCommand(t *testing.T) {
+	t.Parallel()
+
+	setup := newHostSetup(Config{SwapSizeGB: 16, Swappiness: 10, MountVolumes: true, DockerDataRoot: DockerDataRootAuto, MinFreeDiskGB: 200})
+	if !setup.enabled() {
+		t.Fatalf("expected host setup to be enabled")
+	}
+	command := setup.command("lineageos-build")
+	for _, snippet := range []string{
+		"SWAP_SIZE_GB=16 VM_SWAPPINESS=10 MOUNT_VOLUMES=true DOCKER_DATA_ROOT='auto' MIN_FREE_DISK_GB=200 WORK_DIR='lineageos-build'",
+		"/dev/disk/by-id/scsi-0HC_Volume_*",
+		"not enough free disk space",
+	} {
+		if !strings.Contains(command, snippet) {
+			t.Errorf("expected host setup command to contain %q", snippet)
+		}
+	}
+	if (hostSetup{swappiness: -1}).enabled() {
+		t.Errorf("expected default settings to skip host setup")
+	}
+
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	if output, err := exec.Command("bash", "-n", "-c", command).CombinedOutput(); err != nil {
+		t.Errorf("host setup command does not parse: %v\n%s", err, output)
+	}
+}
+
+func TestValidateHostSetup(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []Config{
+		{SwapSizeGB: -1, Swappiness: -1},
+		{Swappiness: 201},
+		{Swappiness: -1, MinFreeDiskGB: -5},
+		{Swappiness: -1, DockerDataRoot: "mnt/docker"},
+	} {
+		if err := validateHostSetup(cfg); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+	if err := validateHostSetup(Config{Swappiness: -1, DockerDataRoot: "/mnt/HC_Volume_1/docker"}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestMarkerValue(t *testing.T) {
+	t.Parallel()
+
+	if value, ok := markerValue("data_root=/old\nnoise\ndata_root=/mnt/docker\n", dataRootMarker); !ok || value != "/mnt/docker" {
+		t.Errorf("markerValue = %q, %v", value, ok)
+	}
+	if value, ok := markerValue("data_root=\n", dataRootMarker); !ok || value != "" {
+		t.Errorf("expected an empty data-root, got %q, %v", value, ok)
+	}
+	if _, ok := markerValue("noise\n", dataRootMarker); ok {
+		t.Errorf("expected no marker")
+	}
+}
@@ -0,0 +1,127 @@
+package lineage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	logBundleDirName     = "logs"
+	logBundleArchiveName = "logs.tar.gz"
+)
+
+// writeLogBundle writes one file per builder phase and one file per compose
+// service under baseDir/logs, then packs that directory into
+// baseDir/logs.tar.gz. Any bundle left over from a previous run is replaced.
+// It returns the path of the tarball.
+func writeLogBundle(baseDir string, phases []phaseLog, serviceLogs map[string]string) (string, error) {
+	dir := filepath.Join(baseDir, logBundleDirName)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("remove old log bundle: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "services"), 0o755); err != nil {
+		return "", fmt.Errorf("create log bundle dir: %w", err)
+	}
+
+	for i, phase := range phases {
+		name := fmt.Sprintf("%02d-%s.log", i+1, phase.Name)
+		if err := writeLogFile(filepath.Join(dir, name), joinLogParts(phase.Lines...)); err != nil {
+			return "", err
+		}
+	}
+	for service, logs := range serviceLogs {
+		name := filepath.Base(service) + ".log"
+		if err := writeLogFile(filepath.Join(dir, "services", name), logs); err != nil {
+			return "", err
+		}
+	}
+
+	archivePath := filepath.Join(baseDir, logBundleArchiveName)
+	if err := archiveDirectory(dir, archivePath); err != nil {
+		return "", fmt.Errorf("archive log bundle: %w", err)
+	}
+	return archivePath, nil
+}
+
+func writeLogFile(path, logs string) error {
+	if logs != "" && !strings.HasSuffix(logs, "\n") {
+		logs += "\n"
+	}
+	if err := os.WriteFile(path, []byte(sanitizeLog(logs)), 0o600); err != nil {
+		return fmt.Errorf("write log file: %w", err)
+	}
+	return nil
+}
+
+// archiveDirectory writes the regular files below dir to a gzip-compressed
+// tarball at archivePath, with paths relative to the parent of dir.
+func archiveDirectory(dir, archivePath string) error {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	out, err := os.OpenFile(filepath.Clean(archivePath), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	parent := filepath.Dir(dir)
+	for _, path := range files {
+		if err := addFileToTar(tw, parent, path); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func addFileToTar(tw *tar.Writer, base, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(rel)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(tw, file)
+	return err
+}
@@ -0,0 +1,46 @@
+package lineage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteLogBundle(t *testing.T) {
+	t.Parallel()
+
+	baseDir := t.TempDir()
+	phases := []phaseLog{
+		{Name: logPhaseStaging, Lines: []string{">>> tar -xzf", "ok"}},
+		{Name: logPhaseComposeUp, Lines: []string{"HETZNER_TOKEN=secret"}},
+	}
+	serviceLogs := map[string]string{"build": "build output"}
+
+	archivePath, err := writeLogBundle(baseDir, phases, serviceLogs)
+	if err != nil {
+		t.Fatalf("write log bundle: %v", err)
+	}
+	if _, err := os.Stat(archivePath); err != nil {
+		t.Fatalf("expected tarball at %s: %v", archivePath, err)
+	}
+
+	expectedFiles := []string{
+		filepath.Join("logs", "01-staging.log"),
+		filepath.Join("logs", "02-compose-up.log"),
+		filepath.Join("logs", "services", "build.log"),
+	}
+	for _, name := range expectedFiles {
+		if _, err := os.Stat(filepath.Join(baseDir, name)); err != nil {
+			t.Errorf("expected %s in log bundle: %v", name, err)
+		}
+	}
+
+	composeUp, err := os.ReadFile(filepath.Join(baseDir, "logs", "02-compose-up.log"))
+	if err != nil {
+		t.Fatalf("read compose-up log: %v", err)
+	}
+	if strings.Contains(string(composeUp), "secret") {
+		t.Errorf("expected log bundle to redact tokens, got %q", composeUp)
+	}
+}
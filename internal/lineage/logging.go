@@ -0,0 +1,234 @@
+package lineage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log formats accepted by ConfigureLogging.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var (
+	logLevel    = new(slog.LevelVar)
+	jsonLogging bool
+	currentRun  runAttrs
+)
+
+// SetLogLevel sets the minimum level of the package logger. It accepts
+// debug, info, warn and error.
+func SetLogLevel(level string) error {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		logLevel.Set(slog.LevelDebug)
+	case "", "info":
+		logLevel.Set(slog.LevelInfo)
+	case "warn", "warning":
+		logLevel.Set(slog.LevelWarn)
+	case "error":
+		logLevel.Set(slog.LevelError)
+	default:
+		return fmt.Errorf("LOG_LEVEL must be one of debug, info, warn or error")
+	}
+	return nil
+}
+
+// debugEnabled reports whether diagnostics should be produced. Remote
+// diagnostic commands are skipped entirely below debug level.
+func debugEnabled() bool {
+	return logLevel.Level() <= slog.LevelDebug
+}
+
+// runAttrs holds the fields attached to every JSON log record while a run is
+// in progress.
+type runAttrs struct {
+	mu       sync.Mutex
+	runID    string
+	phase    string
+	serverID int64
+}
+
+func setRunID(id string) {
+	currentRun.mu.Lock()
+	defer currentRun.mu.Unlock()
+	currentRun.runID = id
+}
+
+func setRunPhase(phase string) {
+	currentRun.mu.Lock()
+	defer currentRun.mu.Unlock()
+	currentRun.phase = phase
+}
+
+func setRunServerID(id int64) {
+	currentRun.mu.Lock()
+	defer currentRun.mu.Unlock()
+	currentRun.serverID = id
+}
+
+func (r *runAttrs) attrs() []slog.Attr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var attrs []slog.Attr
+	if r.runID != "" {
+		attrs = append(attrs, slog.String("run_id", r.runID))
+	}
+	if r.phase != "" {
+		attrs = append(attrs, slog.String("phase", r.phase))
+	}
+	if r.serverID != 0 {
+		attrs = append(attrs, slog.Int64("server_id", r.serverID))
+	}
+	return attrs
+}
+
+// ConfigureLogging installs the default slog logger used throughout the
+// package. The text format keeps the familiar log-package layout; the json
+// format writes one object per record to stderr with the run ID, phase and
+// server ID attached.
+func ConfigureLogging(format string) error {
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", LogFormatText:
+		handler = newTextHandler(os.Stderr, logLevel)
+		jsonLogging = false
+	case LogFormatJSON:
+		handler = &runAttrHandler{Handler: slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})}
+		jsonLogging = true
+	default:
+		return fmt.Errorf("LOG_FORMAT must be %s or %s", LogFormatText, LogFormatJSON)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// runAttrHandler adds the current run attributes to every record.
+type runAttrHandler struct {
+	slog.Handler
+}
+
+func (h *runAttrHandler) Handle(ctx context.Context, record slog.Record) error {
+	record.AddAttrs(currentRun.attrs()...)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *runAttrHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &runAttrHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *runAttrHandler) WithGroup(name string) slog.Handler {
+	return &runAttrHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// textHandler formats records like the standard log package: timestamp,
+// message and key=value attributes. Multi-line values such as remote command
+// output are printed as a block below the line so they stay readable.
+type textHandler struct {
+	mu    *sync.Mutex
+	out   io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func newTextHandler(out io.Writer, level slog.Leveler) *textHandler {
+	return &textHandler{mu: &sync.Mutex{}, out: out, level: level}
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, record slog.Record) error {
+	var line strings.Builder
+	var blocks []string
+	line.WriteString(record.Time.Format("2006/01/02 15:04:05"))
+	line.WriteByte(' ')
+	if record.Level != slog.LevelInfo {
+		line.WriteString(record.Level.String())
+		line.WriteByte(' ')
+	}
+	line.WriteString(record.Message)
+
+	appendAttr := func(attr slog.Attr) bool {
+		value := formatTextValue(attr.Value)
+		if strings.Contains(value, "\n") {
+			blocks = append(blocks, strings.TrimRight(value, "\n"))
+			return true
+		}
+		fmt.Fprintf(&line, " %s=%s", attr.Key, value)
+		return true
+	}
+	for _, attr := range h.attrs {
+		appendAttr(attr)
+	}
+	record.Attrs(appendAttr)
+
+	output := line.String() + "\n"
+	for _, block := range blocks {
+		output += block + "\n"
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, output)
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &clone
+}
+
+// WithGroup is not needed by this package; groups are flattened.
+func (h *textHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func formatTextValue(value slog.Value) string {
+	value = value.Resolve()
+	switch value.Kind() {
+	case slog.KindDuration:
+		return value.Duration().Truncate(time.Millisecond).String()
+	case slog.KindString:
+		text := value.String()
+		if text == "" || (strings.ContainsAny(text, " \t\"=") && !strings.Contains(text, "\n")) {
+			return strconv.Quote(text)
+		}
+		return text
+	default:
+		return value.String()
+	}
+}
+
+// remoteOutputWriter returns where streamed remote output is written: fallback
+// in text mode, or one log record per line in JSON mode so the stream stays
+// machine readable. Streaming is disabled above info level.
+func remoteOutputWriter(stream string, fallback io.Writer) io.Writer {
+	if logLevel.Level() > slog.LevelInfo {
+		return nil
+	}
+	if !jsonLogging {
+		return fallback
+	}
+	return &slogLineWriter{stream: stream}
+}
+
+// slogLineWriter logs each write as one record. lineWriter writes whole lines.
+type slogLineWriter struct {
+	stream string
+}
+
+func (w *slogLineWriter) Write(p []byte) (int, error) {
+	slog.Info("remote output", "stream", w.stream, "line", strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
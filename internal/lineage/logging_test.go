@@ -0,0 +1,63 @@
+package lineage
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunAttrHandlerAddsRunFields(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(&runAttrHandler{Handler: slog.NewJSONHandler(&out, nil)})
+
+	setRunID("abc123")
+	setRunPhase(phaseBuild)
+	setRunServerID(42)
+	defer func() {
+		setRunID("")
+		setRunPhase("")
+		setRunServerID(0)
+	}()
+
+	logger.Info("remote command finished", "command", "hostname", "duration", 1500*time.Millisecond)
+
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("expected a JSON record, got %q: %v", out.String(), err)
+	}
+	expected := map[string]any{
+		"msg":       "remote command finished",
+		"run_id":    "abc123",
+		"phase":     phaseBuild,
+		"server_id": float64(42),
+		"command":   "hostname",
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("expected %s=%v, got %v", key, value, record[key])
+		}
+	}
+}
+
+func TestTextHandlerPrintsMultiLineValuesAsBlocks(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	logger := slog.New(newTextHandler(&out, slog.LevelInfo))
+	logger.Info("[SSH][stdout]", "command", "ls -la", "stdout", "total 0\nfile.txt")
+	logger.Debug("hidden")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", out.String())
+	}
+	if !strings.HasSuffix(lines[0], `[SSH][stdout] command="ls -la"`) {
+		t.Errorf("unexpected first line %q", lines[0])
+	}
+	if lines[1] != "total 0" || lines[2] != "file.txt" {
+		t.Errorf("expected multi-line value as a block, got %q", lines[1:])
+	}
+}
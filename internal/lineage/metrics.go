@@ -0,0 +1,133 @@
+package lineage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const (
+	metricsNamespace      = "lineage_builder"
+	defaultPushgatewayJob = "lineage_builder"
+)
+
+// Build run metrics. They live in their own registry so the endpoint and the
+// Pushgateway only carry build data, not Go runtime metrics.
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	phaseDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "phase_duration_seconds",
+		Help:      "Duration of each orchestrator phase.",
+		Buckets:   []float64{5, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200, 14400, 28800},
+	}, []string{"phase"})
+	serverBootSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "server_boot_seconds",
+		Help:      "Time from server creation until Hetzner reports it running.",
+		Buckets:   prometheus.LinearBuckets(10, 10, 12),
+	})
+	rescueWaitSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "rescue_wait_seconds",
+		Help:      "Time spent waiting for the rescue system to exit and SSH to stabilize.",
+		Buckets:   prometheus.LinearBuckets(60, 60, 10),
+	})
+	transferBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "transfer_bytes_total",
+		Help:      "Bytes uploaded to or downloaded from the build server.",
+	}, []string{"direction"})
+	transferThroughput = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "transfer_throughput_bytes_per_second",
+		Help:      "Throughput of the most recent transfer in each direction.",
+	}, []string{"direction"})
+	buildRunsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "runs_total",
+		Help:      "Build runs by outcome.",
+	}, []string{"outcome"})
+	estimatedCostEUR = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "estimated_cost_eur",
+		Help:      "Estimated server cost of the run in EUR.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		phaseDurationSeconds,
+		serverBootSeconds,
+		rescueWaitSeconds,
+		transferBytesTotal,
+		transferThroughput,
+		buildRunsTotal,
+		estimatedCostEUR,
+	)
+}
+
+// Transfer directions used as metric labels.
+const (
+	transferUpload   = "upload"
+	transferDownload = "download"
+)
+
+func observeTransfer(direction string, bytes int64, duration time.Duration) {
+	transferBytesTotal.WithLabelValues(direction).Add(float64(bytes))
+	if duration > 0 {
+		transferThroughput.WithLabelValues(direction).Set(float64(bytes) / duration.Seconds())
+	}
+}
+
+func recordEstimatedCost(eur float64) {
+	estimatedCostEUR.Set(eur)
+}
+
+// startMetricsServer serves the build metrics on addr under /metrics until
+// the returned shutdown function is called.
+func startMetricsServer(addr string) (func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen for metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("metrics server stopped", "error", err)
+		}
+	}()
+	slog.Info("serving metrics", "addr", listener.Addr().String())
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
+
+// pushMetrics pushes the build metrics to a Prometheus Pushgateway, grouped by
+// server type so runs on different hardware can be compared.
+func pushMetrics(cfg Config) error {
+	job := cfg.PushgatewayJob
+	if job == "" {
+		job = defaultPushgatewayJob
+	}
+	pusher := push.New(cfg.PushgatewayURL, job).
+		Gatherer(metricsRegistry).
+		Grouping("server_type", cfg.ServerType)
+	if err := pusher.Push(); err != nil {
+		return fmt.Errorf("push metrics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package lineage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushMetrics(t *testing.T) {
+	t.Parallel()
+
+	var gotPath, gotBody string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	observeTransfer(transferUpload, 2048, time.Second)
+	if err := pushMetrics(Config{PushgatewayURL: gateway.URL, ServerType: "cpx62"}); err != nil {
+		t.Fatalf("push metrics: %v", err)
+	}
+	if gotPath != "/metrics/job/lineage_builder/server_type/cpx62" {
+		t.Errorf("unexpected push path %q", gotPath)
+	}
+	if !strings.Contains(gotBody, "lineage_builder_transfer_bytes_total") {
+		t.Errorf("expected transfer metric in pushed body")
+	}
+}
@@ -0,0 +1,262 @@
+package lineage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Notification event types, also accepted by NOTIFY_EVENTS.
+const (
+	EventPhase           = "phase"
+	EventSuccess         = "success"
+	EventFailure         = "failure"
+	EventServerKeptAlive = "server-kept-alive"
+)
+
+const (
+	defaultTelegramAPIURL = "https://api.telegram.org"
+	notificationTimeout   = 10 * time.Second
+	webhookSignatureHdr   = "X-Lineage-Signature"
+)
+
+// NotificationEvent is sent to every configured sink. Webhooks receive it as
+// JSON; chat sinks receive the text rendering.
+type NotificationEvent struct {
+	Event      string    `json:"event"`
+	RunID      string    `json:"run_id"`
+	Time       time.Time `json:"time"`
+	Phase      string    `json:"phase,omitempty"`
+	Message    string    `json:"message"`
+	Error      string    `json:"error,omitempty"`
+	ServerID   int64     `json:"server_id,omitempty"`
+	ServerName string    `json:"server_name,omitempty"`
+	ServerIP   string    `json:"server_ip,omitempty"`
+	SSHPort    int       `json:"ssh_port,omitempty"`
+	Datacenter string    `json:"datacenter,omitempty"`
+	Cost       string    `json:"cost,omitempty"`
+}
+
+// text renders the event for chat messages.
+func (e NotificationEvent) text() string {
+	var b strings.Builder
+	switch e.Event {
+	case EventSuccess:
+		b.WriteString("✅ ")
+	case EventFailure:
+		b.WriteString("❌ ")
+	case EventServerKeptAlive:
+		b.WriteString("⚠️ ")
+	}
+	fmt.Fprintf(&b, "LineageOS build %s: %s", e.RunID, e.Message)
+	if e.Error != "" {
+		fmt.Fprintf(&b, "\nError: %s", e.Error)
+	}
+	if e.Cost != "" {
+		fmt.Fprintf(&b, "\nEstimated cost: %s", e.Cost)
+	}
+	if e.Event == EventServerKeptAlive {
+		fmt.Fprintf(&b, "\nServer: %s (%d) in %s", e.ServerName, e.ServerID, e.Datacenter)
+		fmt.Fprintf(&b, "\nConnect: ssh root@%s -p %d", e.ServerIP, e.SSHPort)
+		b.WriteString("\nCleanup: lineage-builder --cleanup")
+	}
+	return b.String()
+}
+
+type notificationSink interface {
+	name() string
+	send(ctx context.Context, client *http.Client, event NotificationEvent) error
+}
+
+// notifier delivers run events to the configured sinks. Delivery failures
+// are logged and never fail the run.
+type notifier struct {
+	client *http.Client
+	sinks  []notificationSink
+	events map[string]bool
+}
+
+func newNotifier(cfg Config) *notifier {
+	n := &notifier{client: &http.Client{Timeout: notificationTimeout}}
+	if cfg.NotifyWebhookURL != "" {
+		n.sinks = append(n.sinks, &webhookSink{url: cfg.NotifyWebhookURL, secret: cfg.NotifyWebhookSecret})
+	}
+	if cfg.NotifyTelegramBotToken != "" && cfg.NotifyTelegramChatID != "" {
+		apiURL := cfg.NotifyTelegramAPIURL
+		if apiURL == "" {
+			apiURL = defaultTelegramAPIURL
+		}
+		n.sinks = append(n.sinks, &telegramSink{apiURL: apiURL, token: cfg.NotifyTelegramBotToken, chatID: cfg.NotifyTelegramChatID})
+	}
+	if cfg.NotifyMatrixHomeserver != "" && cfg.NotifyMatrixAccessToken != "" && cfg.NotifyMatrixRoomID != "" {
+		n.sinks = append(n.sinks, &matrixSink{homeserver: cfg.NotifyMatrixHomeserver, token: cfg.NotifyMatrixAccessToken, roomID: cfg.NotifyMatrixRoomID})
+	}
+	if cfg.NotifyDiscordWebhookURL != "" {
+		n.sinks = append(n.sinks, &discordSink{url: cfg.NotifyDiscordWebhookURL})
+	}
+	if cfg.NotifyEvents != "" {
+		n.events = make(map[string]bool)
+		for _, event := range strings.Split(cfg.NotifyEvents, ",") {
+			n.events[strings.TrimSpace(event)] = true
+		}
+	}
+	return n
+}
+
+// validNotifyEvents reports whether every entry of a NOTIFY_EVENTS list is a
+// known event type.
+func validNotifyEvents(list string) bool {
+	if list == "" {
+		return true
+	}
+	for _, event := range strings.Split(list, ",") {
+		switch strings.TrimSpace(event) {
+		case EventPhase, EventSuccess, EventFailure, EventServerKeptAlive:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Notify sends event to every sink, one after another.
+func (n *notifier) Notify(event NotificationEvent) {
+	if n == nil || len(n.sinks) == 0 {
+		return
+	}
+	if n.events != nil && !n.events[event.Event] {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, sink := range n.sinks {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		if err := sink.send(ctx, n.client, event); err != nil {
+			slog.Warn("failed to send notification", "sink", sink.name(), "event", event.Event, "error", err)
+		}
+		cancel()
+	}
+}
+
+// webhookSink posts the event as JSON. With a secret, the body is signed
+// with HMAC-SHA256 in the X-Lineage-Signature header as "sha256=<hex>".
+type webhookSink struct {
+	url    string
+	secret string
+}
+
+func (s *webhookSink) name() string { return "webhook" }
+
+func (s *webhookSink) send(ctx context.Context, client *http.Client, event NotificationEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	headers := map[string]string{}
+	if s.secret != "" {
+		headers[webhookSignatureHdr] = signWebhookBody(s.secret, body)
+	}
+	return postNotification(ctx, client, http.MethodPost, s.url, body, headers)
+}
+
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// telegramSink sends a message through the Bot API.
+type telegramSink struct {
+	apiURL string
+	token  string
+	chatID string
+}
+
+func (s *telegramSink) name() string { return "telegram" }
+
+func (s *telegramSink) send(ctx context.Context, client *http.Client, event NotificationEvent) error {
+	body, err := json.Marshal(map[string]string{"chat_id": s.chatID, "text": event.text()})
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(s.apiURL, "/"), s.token)
+	return postNotification(ctx, client, http.MethodPost, endpoint, body, nil)
+}
+
+// matrixSink sends an m.text message to a room with the client-server API.
+type matrixSink struct {
+	homeserver string
+	token      string
+	roomID     string
+}
+
+func (s *matrixSink) name() string { return "matrix" }
+
+func (s *matrixSink) send(ctx context.Context, client *http.Client, event NotificationEvent) error {
+	body, err := json.Marshal(map[string]string{"msgtype": "m.text", "body": event.text()})
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+	txnID, err := randomSuffix()
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(s.homeserver, "/"), url.PathEscape(s.roomID), txnID)
+	headers := map[string]string{"Authorization": "Bearer " + s.token}
+	return postNotification(ctx, client, http.MethodPut, endpoint, body, headers)
+}
+
+// discordSink posts to a Discord channel webhook.
+type discordSink struct {
+	url string
+}
+
+func (s *discordSink) name() string { return "discord" }
+
+func (s *discordSink) send(ctx context.Context, client *http.Client, event NotificationEvent) error {
+	body, err := json.Marshal(map[string]string{"content": event.text()})
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+	return postNotification(ctx, client, http.MethodPost, s.url, body, nil)
+}
+
+func postNotification(ctx context.Context, client *http.Client, method, endpoint string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "LineageOS-Hetzner-Build")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// Drop the URL from the error: Telegram carries the bot token in it.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package lineage
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func newNotificationStandIn(t *testing.T) (*httptest.Server, func() []recordedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, recordedRequest{method: r.Method, path: r.URL.EscapedPath(), header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedRequest(nil), requests...)
+	}
+}
+
+func TestNotifierSinks(t *testing.T) {
+	t.Parallel()
+
+	server, requests := newNotificationStandIn(t)
+	n := newNotifier(Config{
+		NotifyWebhookURL:        server.URL + "/hook",
+		NotifyWebhookSecret:     "s3cret",
+		NotifyTelegramBotToken:  "123:abc",
+		NotifyTelegramChatID:    "42",
+		NotifyTelegramAPIURL:    server.URL,
+		NotifyMatrixHomeserver:  server.URL,
+		NotifyMatrixAccessToken: "matrix-token",
+		NotifyMatrixRoomID:      "!room:example.org",
+		NotifyDiscordWebhookURL: server.URL + "/discord",
+	})
+	n.Notify(NotificationEvent{
+		Event:      EventServerKeptAlive,
+		RunID:      "abc123",
+		Message:    "server kept alive for debugging",
+		ServerID:   7,
+		ServerName: "lineageos-builder",
+		ServerIP:   "192.0.2.10",
+		SSHPort:    22,
+		Datacenter: "fsn1-dc14",
+	})
+
+	got := requests()
+	if len(got) != 4 {
+		t.Fatalf("expected 4 requests, got %d", len(got))
+	}
+
+	webhook := got[0]
+	if webhook.path != "/hook" {
+		t.Errorf("unexpected webhook path %q", webhook.path)
+	}
+	if signature := webhook.header.Get(webhookSignatureHdr); signature != signWebhookBody("s3cret", webhook.body) {
+		t.Errorf("unexpected webhook signature %q", signature)
+	}
+	var event NotificationEvent
+	if err := json.Unmarshal(webhook.body, &event); err != nil {
+		t.Fatalf("decode webhook body: %v", err)
+	}
+	if event.Event != EventServerKeptAlive || event.ServerIP != "192.0.2.10" {
+		t.Errorf("unexpected webhook event %+v", event)
+	}
+
+	telegram := got[1]
+	if telegram.path != "/bot123:abc/sendMessage" || !strings.Contains(string(telegram.body), `"chat_id":"42"`) {
+		t.Errorf("unexpected telegram request %s %s", telegram.path, telegram.body)
+	}
+
+	matrix := got[2]
+	if matrix.method != http.MethodPut || !strings.HasPrefix(matrix.path, "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/") {
+		t.Errorf("unexpected matrix request %s %s", matrix.method, matrix.path)
+	}
+	if matrix.header.Get("Authorization") != "Bearer matrix-token" {
+		t.Errorf("missing matrix authorization header")
+	}
+
+	discord := got[3]
+	if !strings.Contains(string(discord.body), "ssh root@192.0.2.10 -p 22") {
+		t.Errorf("expected connection details in discord message, got %s", discord.body)
+	}
+}
+
+func TestNotifierEventFilter(t *testing.T) {
+	t.Parallel()
+
+	server, requests := newNotificationStandIn(t)
+	n := newNotifier(Config{NotifyWebhookURL: server.URL, NotifyEvents: "success, failure"})
+	n.Notify(NotificationEvent{Event: EventPhase, Message: "create Hetzner server"})
+	n.Notify(NotificationEvent{Event: EventFailure, Message: "failed"})
+
+	if got := requests(); len(got) != 1 {
+		t.Errorf("expected only the failure event to be sent, got %d requests", len(got))
+	}
+}
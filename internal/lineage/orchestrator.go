@@ -2,8 +2,9 @@ package lineage
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -14,96 +15,253 @@ import (
 type Orchestrator struct {
 	hetznerClient *HetznerClient
 	cfg           Config
+	actions       *actionsReporter
+	progress      *stageLogger
+	summary       RunSummary
+	notifier      *notifier
+	hooks         []Hook
+	server        *HetznerServer
+	sshClient     *SSHClient
 }
 
 func NewOrchestrator(cfg Config) *Orchestrator {
 	return &Orchestrator{
 		hetznerClient: NewHetznerClient(cfg.HetznerToken),
 		cfg:           cfg,
+		actions:       newActionsReporter(),
+		notifier:      newNotifier(cfg),
 	}
 }
 
-func (o *Orchestrator) Run(ctx context.Context) error {
-	progress := newStageLogger(7)
-	progress.Step("prepare source archive")
-	archivePath, cleanup, err := PrepareRepositoryArchive(ctx, o.cfg)
+// Summary returns the summary of the last call to Run.
+func (o *Orchestrator) Summary() RunSummary {
+	return o.summary
+}
+
+func (o *Orchestrator) Run(ctx context.Context) (err error) {
+	runID, err := randomSuffix()
 	if err != nil {
 		return err
 	}
-	defer cleanup()
+	setRunID(runID)
+	o.summary = RunSummary{RunID: runID, StartedAt: time.Now()}
+	for _, secret := range []string{o.cfg.HetznerToken, o.cfg.BuildSourceToken, o.cfg.RegistryPassword, o.cfg.NotifyWebhookURL, o.cfg.NotifyWebhookSecret, o.cfg.NotifyDiscordWebhookURL, o.cfg.NotifyTelegramBotToken, o.cfg.NotifyMatrixAccessToken} {
+		o.actions.Mask(secret)
+	}
+
+	o.progress = newStageLogger(7, o.actions)
+	if o.cfg.MetricsListenAddr != "" {
+		shutdown, metricsErr := startMetricsServer(o.cfg.MetricsListenAddr)
+		if metricsErr != nil {
+			slog.Warn("metrics endpoint disabled", "error", metricsErr)
+		} else {
+			defer shutdown()
+		}
+	}
+	defer func() { o.finishRun(err) }()
 
-	progress.Step("create Hetzner server")
-	server, err := o.hetznerClient.CreateServer(ctx, o.cfg)
+	o.hooks, err = LoadHooks(o.cfg.HooksFile)
 	if err != nil {
 		return err
 	}
-	log.Printf("server created: id=%d name=%s ip=%s datacenter=%s", server.ID, server.Name, server.IP, server.Datacenter)
+
+	if err := o.step(ctx, phasePrepareSource, "prepare source archive"); err != nil {
+		return err
+	}
+	// A git source is cloned on the server, so nothing is prepared locally.
+	// In stream and sync mode no archive is written; the source is archived
+	// while it is sent to the server.
+	var provenance *SourceProvenance
+	var archivePath string
+	var sourceMatcher *excludeMatcher
+	if o.cfg.BuildSource != "" {
+		slog.Info("source will be cloned on the server", "repository", RedactSourceURL(o.cfg.BuildSource), "ref", o.cfg.BuildSourceRef)
+	} else {
+		provenance, err = prepareSourceProvenance(ctx, o.cfg)
+		if err != nil {
+			return err
+		}
+		o.summary.Source = provenance
+	}
+	switch {
+	case o.cfg.BuildSource != "":
+	case o.cfg.SourceTransfer != SourceTransferArchive:
+		sourceMatcher, err = prepareSourceMatcher(ctx, o.cfg)
+		if err != nil {
+			return err
+		}
+	default:
+		var cleanup func()
+		archivePath, cleanup, err = PrepareRepositoryArchive(ctx, o.cfg, provenance)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+	}
+
+	if err := o.step(ctx, phaseCreateServer, "create Hetzner server"); err != nil {
+		return err
+	}
+	// Refuse a budget below one billed hour before any server is paid for.
+	if o.cfg.MaxCostEUR > 0 {
+		pricings, err := o.hetznerClient.ServerPricings(ctx, o.cfg.ServerType, o.cfg.ServerLocation)
+		if err != nil {
+			return fmt.Errorf("resolve price for MAX_COST_EUR: %w", err)
+		}
+		if err := checkBudget(pricings, o.cfg.MaxCostEUR); err != nil {
+			return err
+		}
+	}
+	var server *HetznerServer
+	if o.cfg.ReuseServer {
+		server, err = o.reusableServer(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	reused := server != nil
+	if reused {
+		slog.Info("reusing server from previous run", "server_id", server.ID, "name", server.Name, "ip", server.IP, "datacenter", server.Datacenter)
+	} else {
+		server, err = o.hetznerClient.CreateServer(ctx, o.cfg)
+		if err != nil {
+			return err
+		}
+		slog.Info("server created", "server_id", server.ID, "name", server.Name, "ip", server.IP, "datacenter", server.Datacenter)
+	}
+	// For a reused server this is when this run started using it.
+	serverCreatedAt := time.Now()
+	// Hetzner bills every started hour since the server was created, which
+	// for a reused server lies in an earlier run.
+	billingStart := serverCreatedAt
+	if reused && !server.Created.IsZero() {
+		billingStart = server.Created
+	}
+	o.server = server
+	if server.Pricing != nil {
+		slog.Info("server price", "location", server.Location, "hourly", fmt.Sprintf("%.4f %s", server.Pricing.HourlyGross, server.Pricing.Currency))
+	}
+	o.summary.ServerID = server.ID
+	setRunServerID(server.ID)
+	o.summary.ServerName = server.Name
 
 	// Save server state for potential cleanup after crash
-	if err := SaveServerState(o.cfg.ServerStatePath, server); err != nil {
-		log.Printf("warning: failed to save server state: %v", err)
+	if err := SaveServerState(o.cfg.ServerStatePath, server, o.cfg.ReuseServer); err != nil {
+		slog.Warn("failed to save server state", "error", err)
 	}
 
-	// Track whether we should delete the server
-	shouldDeleteServer := true
+	// Track whether we should delete the server. With REUSE_SERVER it is
+	// kept for the next run.
+	shouldDeleteServer := !o.cfg.ReuseServer
 
 	defer func() {
 		if shouldDeleteServer {
-			log.Printf("cleaning up server %d and ssh keys", server.ID)
+			slog.Info("cleaning up server and ssh keys", "server_id", server.ID)
 			// Use a timeout context for cleanup to prevent hanging indefinitely
 			cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
 
+			o.recordServerCost(cleanupCtx, server, serverCreatedAt, false)
 			if err := o.hetznerClient.DeleteServer(cleanupCtx, server.ID); err != nil {
-				log.Printf("failed to delete server %d: %v", server.ID, err)
+				slog.Error("failed to delete server", "server_id", server.ID, "error", err)
 			}
 			if err := o.hetznerClient.DeleteSSHKey(cleanupCtx, server.SSHKeyID); err != nil {
-				log.Printf("failed to delete ssh key %d: %v", server.SSHKeyID, err)
+				slog.Error("failed to delete ssh key", "ssh_key_id", server.SSHKeyID, "error", err)
 			}
 			// Delete GitHub user SSH keys
 			for _, keyID := range server.GitHubKeyIDs {
 				if err := o.hetznerClient.DeleteSSHKey(cleanupCtx, keyID); err != nil {
-					log.Printf("failed to delete GitHub SSH key %d: %v", keyID, err)
+					slog.Error("failed to delete GitHub SSH key", "ssh_key_id", keyID, "error", err)
 				}
 			}
 			// Clean up state file after successful deletion
 			if err := DeleteServerState(o.cfg.ServerStatePath); err != nil {
-				log.Printf("warning: failed to delete server state file: %v", err)
+				slog.Warn("failed to delete server state file", "error", err)
 			}
+		} else if o.cfg.ReuseServer {
+			costCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			o.recordServerCost(costCtx, server, serverCreatedAt, true)
+			cancel()
+			slog.Info("server kept for the next run (REUSE_SERVER=true)", "server_id", server.ID, "ip", server.IP, "state_file", o.cfg.ServerStatePath)
+			slog.Info("the server keeps being billed until it is removed with: lineage-builder --cleanup")
 		} else {
-			log.Printf("⚠️  WARNING: Server is being kept alive due to KEEP_SERVER_ON_FAILURE=true")
-			log.Printf("⚠️  Server details:")
-			log.Printf("⚠️    ID: %d", server.ID)
-			log.Printf("⚠️    Name: %s", server.Name)
-			log.Printf("⚠️    IP: %s", server.IP)
-			log.Printf("⚠️    SSH Port: %d", server.SSHPort)
-			log.Printf("⚠️    Datacenter: %s", server.Datacenter)
-			log.Printf("⚠️  To connect: ssh root@%s -p %d", server.IP, server.SSHPort)
-			log.Printf("⚠️  Server state saved to: %s", o.cfg.ServerStatePath)
-			log.Printf("⚠️  To cleanup later, run: lineage-builder --cleanup")
+			costCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			o.recordServerCost(costCtx, server, serverCreatedAt, true)
+			cancel()
+			slog.Info("⚠️  WARNING: Server is being kept alive due to KEEP_SERVER_ON_FAILURE=true")
+			slog.Info("⚠️  Server details:")
+			slog.Info(fmt.Sprintf("⚠️    ID: %d", server.ID))
+			slog.Info(fmt.Sprintf("⚠️    Name: %s", server.Name))
+			slog.Info(fmt.Sprintf("⚠️    IP: %s", server.IP))
+			slog.Info(fmt.Sprintf("⚠️    SSH Port: %d", server.SSHPort))
+			slog.Info(fmt.Sprintf("⚠️    Datacenter: %s", server.Datacenter))
+			slog.Info(fmt.Sprintf("⚠️  To connect: ssh root@%s -p %d", server.IP, server.SSHPort))
+			slog.Info(fmt.Sprintf("⚠️  Server state saved to: %s", o.cfg.ServerStatePath))
+			slog.Info("⚠️  To cleanup later, run: lineage-builder --cleanup")
+			o.notifyServerKeptAlive(server)
 		}
 	}()
 
-	progress.Step("wait for server to be running")
-	log.Printf("waiting for server %d to reach running status...", server.ID)
+	if o.cfg.MaxCostEUR > 0 {
+		if server.Pricing == nil {
+			return fmt.Errorf("MAX_COST_EUR is set but the price of %s in %s is unknown", o.cfg.ServerType, server.Location)
+		}
+		var cancelBudget context.CancelCauseFunc
+		ctx, cancelBudget = context.WithCancelCause(ctx)
+		defer cancelBudget(nil)
+		stopBudget, budgetErr := startBudgetGuard(*server.Pricing, o.cfg.MaxCostEUR, billingStart, cancelBudget)
+		if budgetErr != nil {
+			return budgetErr
+		}
+		defer stopBudget()
+		defer func() {
+			var budgetErr *budgetExceededError
+			if err == nil || !errors.As(context.Cause(ctx), &budgetErr) {
+				return
+			}
+			// A server that would keep billing past the ceiling is never kept,
+			// not even for REUSE_SERVER or KEEP_SERVER_ON_FAILURE.
+			shouldDeleteServer = true
+			o.summary.FailureReason = &FailureReason{
+				Category: failureCategoryBudget,
+				Summary:  "cost ceiling reached",
+				Evidence: budgetErr.Error(),
+			}
+			err = fmt.Errorf("%w: %w", budgetErr, err)
+		}()
+	}
+
+	if err := o.step(ctx, phaseWaitRunning, "wait for server to be running"); err != nil {
+		if o.cfg.KeepServerOnFailure {
+			shouldDeleteServer = false
+		}
+		return err
+	}
+	slog.Info("waiting for server to reach running status", "server_id", server.ID)
 	if err := o.hetznerClient.WaitForServer(ctx, server.ID); err != nil {
 		if o.cfg.KeepServerOnFailure {
 			shouldDeleteServer = false
 		}
 		return fmt.Errorf("wait for server: %w", err)
 	}
-	log.Printf("server %d is running", server.ID)
+	slog.Info("server is running", "server_id", server.ID)
+	serverBootSeconds.Observe(time.Since(serverCreatedAt).Seconds())
 
 	addr := fmt.Sprintf("%s:%d", server.IP, server.SSHPort)
-	progress.Step("wait for SSH to become available")
-	log.Printf("waiting for SSH port on %s...", addr)
+	if err := o.step(ctx, phaseWaitSSH, "wait for SSH to become available"); err != nil {
+		if o.cfg.KeepServerOnFailure {
+			shouldDeleteServer = false
+		}
+		return err
+	}
+	slog.Info("waiting for SSH port", "addr", addr)
 	if err := waitForPort(ctx, addr, 5*time.Minute); err != nil {
 		if o.cfg.KeepServerOnFailure {
 			shouldDeleteServer = false
 		}
 		return fmt.Errorf("wait for ssh: %w", err)
 	}
-	log.Printf("SSH port is open on %s", addr)
+	slog.Info("SSH port is open", "addr", addr)
 
 	sshClient, err := NewSSHClient(addr, server.SSHUser, server.SSHKey, 30*time.Second)
 	if err != nil {
@@ -113,8 +271,9 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 		return err
 	}
 	// 设置实时输出到 GitHub Actions 日志
-	sshClient.Stdout = os.Stdout
-	sshClient.Stderr = os.Stderr
+	sshClient.Stdout = remoteOutputWriter("stdout", os.Stdout)
+	sshClient.Stderr = remoteOutputWriter("stderr", os.Stderr)
+	o.sshClient = sshClient
 
 	// Wait for rescue mode to exit and verify stable SSH connectivity.
 	// The stability check requires the connection to be stable for stabilityDuration,
@@ -122,58 +281,125 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 	// 8 minutes is enough for Hetzner's rescue system to complete provisioning.
 	// 2 minutes of stability is sufficient to confirm the OS is fully operational
 	// and won't undergo additional reboots (based on observed Hetzner boot patterns).
+	// A reused server booted in an earlier run, so there is nothing to wait for.
 	const rescueExitTimeout = 8 * time.Minute
 	const stabilityDuration = 2 * time.Minute
-	log.Printf("waiting for rescue system to exit and SSH to stabilize (stability duration: %v)...", stabilityDuration)
-	if err := waitForStableSSH(ctx, sshClient, rescueExitTimeout, stabilityDuration); err != nil {
-		if o.cfg.KeepServerOnFailure {
-			shouldDeleteServer = false
+	if !reused {
+		slog.Info("waiting for rescue system to exit and SSH to stabilize", "stability_duration", stabilityDuration)
+		rescueWaitStart := time.Now()
+		if err := waitForStableSSH(ctx, sshClient, rescueExitTimeout, stabilityDuration); err != nil {
+			if o.cfg.KeepServerOnFailure {
+				shouldDeleteServer = false
+			}
+			return err
 		}
-		return err
+		slog.Info("SSH connection is stable, system has exited rescue mode")
+		rescueWaitSeconds.Observe(time.Since(rescueWaitStart).Seconds())
 	}
-	log.Printf("SSH connection is stable, system has exited rescue mode")
 
 	builder := NewBuilder(sshClient, o.cfg)
+	if builder.sourceFiles, err = provenanceFiles(provenance); err != nil {
+		return err
+	}
+	defer o.saveLogBundle(builder)
 	buildCtx, cancel := context.WithTimeout(ctx, time.Duration(o.cfg.BuildTimeoutMinutes)*time.Minute)
 	defer cancel()
 
-	progress.Step("stage source on server")
-	log.Printf("uploading source archive to server...")
-	if err := builder.StageSource(buildCtx, archivePath); err != nil {
+	if err := o.step(ctx, phaseStageSource, "stage source on server"); err != nil {
+		if o.cfg.KeepServerOnFailure {
+			shouldDeleteServer = false
+		}
+		return err
+	}
+	if err := builder.PrepareHost(buildCtx); err != nil {
+		if o.cfg.KeepServerOnFailure {
+			shouldDeleteServer = false
+		}
+		return err
+	}
+	var stageErr error
+	switch {
+	case o.cfg.BuildSource != "":
+		slog.Info("cloning source on server")
+		o.summary.Source, stageErr = builder.CloneSource(buildCtx, o.cfg.BuildSource, o.cfg.BuildSourceRef, o.cfg.BuildSourceToken)
+	case o.cfg.SourceTransfer == SourceTransferStream:
+		slog.Info("streaming source to server")
+		stageErr = builder.StreamSource(buildCtx, o.cfg.BuildSourceDir, sourceMatcher)
+	case o.cfg.SourceTransfer == SourceTransferSync:
+		slog.Info("syncing source to server")
+		stageErr = builder.SyncSource(buildCtx, o.cfg.BuildSourceDir, sourceMatcher)
+	default:
+		slog.Info("uploading source archive to server")
+		stageErr = builder.StageSource(buildCtx, archivePath)
+	}
+	if err := stageErr; err != nil {
 		if o.cfg.KeepServerOnFailure {
 			shouldDeleteServer = false
 		}
 		return err
 	}
-	log.Printf("source staged successfully")
+	slog.Info("source staged successfully")
 
-	progress.Step("run build on server")
-	log.Printf("starting build...")
+	if err := o.step(ctx, phaseBuild, "run build on server"); err != nil {
+		if o.cfg.KeepServerOnFailure {
+			shouldDeleteServer = false
+		}
+		return err
+	}
+	slog.Info("starting build")
 	result, err := builder.Run(buildCtx)
+	if result.ExitCode >= 0 {
+		o.summary.ExitCode = &result.ExitCode
+	}
 	if err != nil {
-		log.Printf("build failed, collecting remote logs")
+		slog.Error("build failed, collecting remote logs")
 		builderLogs := strings.TrimSpace(builder.joinLogs())
 		if builderLogs != "" {
-			log.Printf("remote command logs:\n%s", sanitizeLog(builderLogs))
+			slog.Info("remote command logs", "logs", sanitizeLog(builderLogs))
 		}
-		remoteLogs, logErr := builder.SaveRemoteLogs(ctx)
+		// Use a fresh context so logs are still collected after a timeout or
+		// when the cost ceiling cancelled the run.
+		logCtx, cancelLogs := context.WithTimeout(context.Background(), 2*time.Minute)
+		remoteLogs, logErr := builder.SaveRemoteLogs(logCtx)
+		cancelLogs()
 		combinedLogs := builderLogs
 		if logErr != nil {
-			log.Printf("failed to collect remote logs: %v", logErr)
+			slog.Warn("failed to collect remote logs", "error", logErr)
 		} else {
 			combinedLogs = joinLogParts(builderLogs, remoteLogs)
 		}
 		if combinedLogs != "" {
 			_ = saveLogs(o.cfg, sanitizeLog(combinedLogs))
 		}
+		if errors.Is(err, errNoArtifacts) {
+			o.summary.FailureReason = &FailureReason{
+				Category: failureCategoryNoArtifacts,
+				Summary:  "build succeeded but produced no artifacts",
+				Evidence: fmt.Sprintf("nothing matched %s/%s", o.cfg.ArtifactDir, o.cfg.ArtifactPattern),
+			}
+		} else {
+			o.summary.FailureReason = classifyBuildFailure(combinedLogs)
+			o.summary.LikelyCause = o.collectDiagnostics(builder)
+		}
 		if o.cfg.KeepServerOnFailure {
 			shouldDeleteServer = false
 		}
+		if reason := o.summary.FailureReason; reason != nil {
+			return fmt.Errorf("build failed (%s): %w", reason, err)
+		}
+		if cause := o.summary.LikelyCause; cause != "" {
+			return fmt.Errorf("build failed (likely %s): %w", cause, err)
+		}
 		return fmt.Errorf("build failed: %w", err)
 	}
-	log.Printf("build completed successfully")
+	slog.Info("build completed successfully")
 
-	progress.Step("download artifacts")
+	if err := o.step(ctx, phaseDownloadArtifacts, "download artifacts"); err != nil {
+		if o.cfg.KeepServerOnFailure {
+			shouldDeleteServer = false
+		}
+		return err
+	}
 	artifacts, err := builder.DownloadArtifacts(ctx, result.Artifacts)
 	if err != nil {
 		if o.cfg.KeepServerOnFailure {
@@ -181,39 +407,290 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 		}
 		return err
 	}
-	log.Printf("downloaded %d artifacts", len(artifacts))
+	slog.Info("downloaded artifacts", "count", len(artifacts))
+	o.summary.Artifacts = artifacts
+
+	if err := o.runHooks(ctx, hookPost, phaseDownloadArtifacts); err != nil {
+		if o.cfg.KeepServerOnFailure {
+			shouldDeleteServer = false
+		}
+		return err
+	}
 
 	return nil
 }
 
+// Orchestrator phases, used for progress output, log groups and timings.
+const (
+	phasePrepareSource     = "prepare-source"
+	phaseCreateServer      = "create-server"
+	phaseWaitRunning       = "wait-running"
+	phaseWaitSSH           = "wait-ssh"
+	phaseStageSource       = "stage-source"
+	phaseBuild             = "build"
+	phaseDownloadArtifacts = "download-artifacts"
+)
+
 type stageLogger struct {
-	total    int
-	current  int
-	barWidth int
+	total      int
+	current    int
+	barWidth   int
+	actions    *actionsReporter
+	phase      string
+	title      string
+	phaseStart time.Time
+	timings    []PhaseTiming
 }
 
-func newStageLogger(total int) *stageLogger {
+func newStageLogger(total int, actions *actionsReporter) *stageLogger {
 	return &stageLogger{
 		total:    total,
 		barWidth: 20,
+		actions:  actions,
 	}
 }
 
-func (s *stageLogger) Step(message string) {
+// Step ends the current phase and starts the named one. In GitHub Actions
+// each phase is wrapped in its own log group.
+func (s *stageLogger) Step(phase, message string) {
+	s.endPhase()
+	s.phase = phase
+	s.title = message
+	s.phaseStart = time.Now()
+	setRunPhase(phase)
+
 	if s.total <= 0 {
-		log.Printf("%s", message)
+		s.actions.StartGroup(message)
+		slog.Info(message)
 		return
 	}
 	if s.current < s.total {
 		s.current++
 	}
+	s.actions.StartGroup(fmt.Sprintf("%d/%d %s", s.current, s.total, message))
 	filled := s.current * s.barWidth / s.total
 	if filled > s.barWidth {
 		filled = s.barWidth
 	}
 	bar := fmt.Sprintf("[%s%s]", strings.Repeat("#", filled), strings.Repeat("-", s.barWidth-filled))
 	percent := s.current * 100 / s.total
-	log.Printf("%s %d/%d %3d%% %s", bar, s.current, s.total, percent, message)
+	slog.Info(fmt.Sprintf("%s %d/%d %3d%% %s", bar, s.current, s.total, percent, message))
+}
+
+// Finish ends the current phase and returns the timings of all phases.
+func (s *stageLogger) Finish() []PhaseTiming {
+	s.endPhase()
+	s.actions.EndGroup()
+	return s.timings
+}
+
+func (s *stageLogger) endPhase() {
+	if s.phase == "" {
+		return
+	}
+	duration := time.Since(s.phaseStart)
+	slog.Info("phase finished", "duration", duration)
+	phaseDurationSeconds.WithLabelValues(s.phase).Observe(duration.Seconds())
+	s.timings = append(s.timings, PhaseTiming{
+		Name:    s.phase,
+		Title:   s.title,
+		Seconds: duration.Seconds(),
+	})
+	s.phase = ""
+	setRunPhase("")
+}
+
+// step runs the post hooks of the current phase, starts the next phase,
+// notifies about it and runs its pre hooks.
+func (o *Orchestrator) step(ctx context.Context, phase, message string) error {
+	if o.progress.phase != "" {
+		if err := o.runHooks(ctx, hookPost, o.progress.phase); err != nil {
+			return err
+		}
+	}
+	o.progress.Step(phase, message)
+	o.notifier.Notify(NotificationEvent{
+		Event:    EventPhase,
+		RunID:    o.summary.RunID,
+		Phase:    phase,
+		Message:  message,
+		ServerID: o.summary.ServerID,
+	})
+	return o.runHooks(ctx, hookPre, phase)
+}
+
+// notifyServerKeptAlive sends the connection details of a server left
+// running by KEEP_SERVER_ON_FAILURE.
+func (o *Orchestrator) notifyServerKeptAlive(server *HetznerServer) {
+	event := NotificationEvent{
+		Event:      EventServerKeptAlive,
+		RunID:      o.summary.RunID,
+		Message:    "server kept alive for debugging",
+		ServerID:   server.ID,
+		ServerName: server.Name,
+		ServerIP:   server.IP,
+		SSHPort:    server.SSHPort,
+		Datacenter: server.Datacenter,
+	}
+	if server.Pricing != nil {
+		event.Cost = fmt.Sprintf("%.4f %s per hour while it keeps running", server.Pricing.HourlyGross, server.Pricing.Currency)
+	}
+	o.notifier.Notify(event)
+}
+
+// reusableServer returns the server persisted by a previous REUSE_SERVER
+// run, or nil when there is none that can be used. A persisted server that
+// cannot be reused is deleted, since it keeps being billed, holds the
+// configured server name and would lose its only record once the new
+// server's state is saved.
+func (o *Orchestrator) reusableServer(ctx context.Context) (*HetznerServer, error) {
+	state, err := LoadServerState(o.cfg.ServerStatePath)
+	if err != nil {
+		slog.Warn("cannot reuse server", "error", err)
+		return nil, nil
+	}
+	if state == nil {
+		return nil, nil
+	}
+	reason := "no SSH key was saved"
+	if state.SSHPrivateKey != "" {
+		var server *HetznerServer
+		server, reason, err = o.hetznerClient.ReusableServer(ctx, state, o.cfg)
+		if err != nil {
+			return nil, fmt.Errorf("look up persisted server %d: %w", state.ServerID, err)
+		}
+		if server != nil {
+			return server, nil
+		}
+		if reason == "" {
+			reason = "server no longer exists"
+		}
+	}
+	slog.Warn("persisted server cannot be reused, deleting it", "server_id", state.ServerID, "name", state.ServerName, "reason", reason)
+	if err := deletePersistedServer(ctx, o.hetznerClient, o.cfg.ServerStatePath, state); err != nil {
+		return nil, fmt.Errorf("delete persisted server %d (%s), run lineage-builder --cleanup: %w", state.ServerID, reason, err)
+	}
+	return nil, nil
+}
+
+// saveLogBundle writes the per-phase log bundle to LocalArtifactDir. It runs
+// for every outcome once the builder exists, before the server is deleted.
+func (o *Orchestrator) saveLogBundle(builder *Builder) {
+	if o.cfg.LocalArtifactDir == "" {
+		return
+	}
+	// Use a fresh context so logs are still collected after a build timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	var serviceLogs map[string]string
+	if builder.reachedPhase(logPhaseComposePull) {
+		var err error
+		serviceLogs, err = builder.SaveServiceLogs(ctx)
+		if err != nil {
+			slog.Warn("failed to collect compose service logs", "error", err)
+		}
+	}
+	path, err := writeLogBundle(o.cfg.LocalArtifactDir, builder.phaseLogs, serviceLogs)
+	if err != nil {
+		slog.Warn("failed to write log bundle", "error", err)
+		return
+	}
+	slog.Info("log bundle saved", "path", path)
+}
+
+// finishRun records the outcome in the run summary, logs it and writes it to
+// LocalArtifactDir.
+func (o *Orchestrator) finishRun(err error) {
+	o.summary.Phases = o.progress.Finish()
+	o.summary.finish(err)
+	o.summary.logSummary()
+	buildRunsTotal.WithLabelValues(o.summary.Outcome).Inc()
+	if o.cfg.PushgatewayURL != "" {
+		if pushErr := pushMetrics(o.cfg); pushErr != nil {
+			slog.Warn("failed to push metrics", "error", pushErr)
+		}
+	}
+	if err != nil {
+		o.actions.Error("LineageOS build failed", err.Error())
+	}
+	o.notifyOutcome()
+	o.reportToActions()
+	if o.cfg.LocalArtifactDir == "" {
+		return
+	}
+	if _, writeErr := writeRunSummary(o.cfg.LocalArtifactDir, &o.summary); writeErr != nil {
+		slog.Warn("failed to write run summary", "error", writeErr)
+	}
+}
+
+// notifyOutcome sends the success or failure event of the finished run.
+func (o *Orchestrator) notifyOutcome() {
+	event := NotificationEvent{
+		Event:      EventSuccess,
+		RunID:      o.summary.RunID,
+		Message:    fmt.Sprintf("succeeded in %s with %d artifact(s)", o.summary.Duration().Truncate(time.Second), len(o.summary.Artifacts)),
+		ServerID:   o.summary.ServerID,
+		ServerName: o.summary.ServerName,
+	}
+	if o.summary.Outcome != runOutcomeSuccess {
+		event.Event = EventFailure
+		event.Message = fmt.Sprintf("failed after %s", o.summary.Duration().Truncate(time.Second))
+		event.Error = o.summary.Error
+	}
+	if o.summary.Cost != nil {
+		event.Cost = o.summary.Cost.String()
+	}
+	o.notifier.Notify(event)
+}
+
+// reportToActions writes the step outputs and the Markdown step summary.
+func (o *Orchestrator) reportToActions() {
+	outputs := []struct{ name, value string }{
+		{"outcome", o.summary.Outcome},
+		{"server-id", fmt.Sprintf("%d", o.summary.ServerID)},
+		{"exit-code", exitCodeOutput(o.summary.ExitCode)},
+		{"artifacts", strings.Join(o.summary.Artifacts, "\n")},
+	}
+	for _, output := range outputs {
+		if err := o.actions.SetOutput(output.name, output.value); err != nil {
+			slog.Warn("failed to set step output", "output", output.name, "error", err)
+		}
+	}
+	if err := o.actions.WriteStepSummary(renderRunSummaryMarkdown(&o.summary)); err != nil {
+		slog.Warn("failed to write step summary", "error", err)
+	}
+}
+
+// exitCodeOutput formats the build exit code as a step output, empty when
+// the build did not finish.
+func exitCodeOutput(code *int) string {
+	if code == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d", *code)
+}
+
+// collectDiagnostics downloads the remote diagnostics bundle after a failed
+// build, logs the most likely cause it points to and returns it.
+func (o *Orchestrator) collectDiagnostics(builder *Builder) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	slog.Info("collecting remote diagnostics")
+	path, cause, err := builder.CollectDiagnostics(ctx)
+	if err != nil {
+		slog.Warn("failed to collect diagnostics", "error", err)
+	}
+	if path != "" {
+		slog.Info("diagnostics saved", "path", path)
+	}
+	if cause != "" {
+		slog.Info("most likely cause", "cause", cause)
+	} else if err == nil {
+		slog.Info("diagnostics did not point to an obvious cause (OOM, disk full, sync failure)")
+	}
+	return cause
 }
 
 func saveLogs(cfg Config, logs string) error {
@@ -252,7 +729,7 @@ func waitForStableSSH(ctx context.Context, sshClient *SSHClient, timeout, stabil
 		// Try to connect and get hostname
 		hostname, _, hostnameErr := sshClient.Run(ctx, "hostname")
 		if hostnameErr != nil {
-			log.Printf("SSH connection attempt failed: %v", hostnameErr)
+			slog.Info("SSH connection attempt failed", "error", hostnameErr)
 			stableStart = time.Time{} // Reset stability timer
 			if err := sleepWithContext(ctx, checkInterval); err != nil {
 				return err
@@ -260,11 +737,11 @@ func waitForStableSSH(ctx context.Context, sshClient *SSHClient, timeout, stabil
 			continue
 		}
 		hostname = strings.TrimSpace(hostname)
-		log.Printf("SSH connected, hostname=%s", hostname)
+		slog.Info("SSH connected", "hostname", hostname)
 
 		// Check if still in rescue mode
 		if isRescueHostname(hostname) {
-			log.Printf("system still in rescue mode (hostname=%s), waiting...", hostname)
+			slog.Info("system still in rescue mode, waiting", "hostname", hostname)
 			stableStart = time.Time{} // Reset stability timer
 			if err := sleepWithContext(ctx, checkInterval); err != nil {
 				return err
@@ -275,7 +752,7 @@ func waitForStableSSH(ctx context.Context, sshClient *SSHClient, timeout, stabil
 		// Check root filesystem
 		rootFs, _, rootFsErr := sshClient.Run(ctx, "df -T /")
 		if rootFsErr != nil {
-			log.Printf("failed to check root filesystem: %v", rootFsErr)
+			slog.Info("failed to check root filesystem", "error", rootFsErr)
 			stableStart = time.Time{} // Reset stability timer
 			if err := sleepWithContext(ctx, checkInterval); err != nil {
 				return err
@@ -283,7 +760,7 @@ func waitForStableSSH(ctx context.Context, sshClient *SSHClient, timeout, stabil
 			continue
 		}
 		if isRescueRootFilesystem(rootFs) {
-			log.Printf("system has rescue root filesystem (tmpfs/ramfs), waiting...")
+			slog.Info("system has rescue root filesystem (tmpfs/ramfs), waiting")
 			stableStart = time.Time{} // Reset stability timer
 			if err := sleepWithContext(ctx, checkInterval); err != nil {
 				return err
@@ -294,20 +771,20 @@ func waitForStableSSH(ctx context.Context, sshClient *SSHClient, timeout, stabil
 		// System has exited rescue mode, start/continue stability check
 		if stableStart.IsZero() || hostname != lastHostname {
 			if lastHostname != "" && hostname != lastHostname {
-				log.Printf("hostname changed from %s to %s, resetting stability timer", lastHostname, hostname)
+				slog.Info("hostname changed, resetting stability timer", "from", lastHostname, "to", hostname)
 			}
 			stableStart = time.Now()
 			lastHostname = hostname
-			log.Printf("starting stability check for %v (hostname=%s)", stabilityDuration, hostname)
+			slog.Info("starting stability check", "duration", stabilityDuration, "hostname", hostname)
 		}
 
 		stableDuration := time.Since(stableStart)
 		if stableDuration >= stabilityDuration {
-			log.Printf("SSH connection stable for %v, proceeding", stableDuration)
+			slog.Info("SSH connection stable, proceeding", "duration", stableDuration)
 			return nil
 		}
 
-		log.Printf("SSH stable for %v/%v", stableDuration.Truncate(time.Second), stabilityDuration)
+		slog.Info(fmt.Sprintf("SSH stable for %v/%v", stableDuration.Truncate(time.Second), stabilityDuration))
 		if err := sleepWithContext(ctx, checkInterval); err != nil {
 			return err
 		}
@@ -0,0 +1,140 @@
+package lineage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+)
+
+// provenanceFileName is added to the root of the source archive when
+// BuildSourceDir is part of a git repository.
+const provenanceFileName = ".lineage-provenance.json"
+
+// SourceProvenance records which commit of the source repository was built.
+// Dirty and DiffStat only cover BuildSourceDir, which may be a subdirectory
+// of the repository. Repository and Ref are set for BUILD_SOURCE clones.
+type SourceProvenance struct {
+	Repository string `json:"repository,omitempty"`
+	Ref        string `json:"ref,omitempty"`
+	Commit     string `json:"commit"`
+	Branch     string `json:"branch,omitempty"`
+	Dirty      bool   `json:"dirty"`
+	DiffStat   string `json:"diff_stat,omitempty"`
+}
+
+// String formats the provenance for logs, e.g. "main@1a2b3c4d (dirty)".
+func (p *SourceProvenance) String() string {
+	commit := p.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if commit == "" {
+		commit = "(no commits)"
+	}
+	ref := commit
+	if p.Branch != "" {
+		ref = p.Branch + "@" + commit
+	} else if p.Ref != "" {
+		ref = p.Ref + "@" + commit
+	}
+	if p.Dirty {
+		ref += " (dirty)"
+	}
+	return ref
+}
+
+// detectSourceProvenance reads the git state of dir. It returns nil when git
+// is not installed or dir is not inside a work tree.
+func detectSourceProvenance(ctx context.Context, dir string) (*SourceProvenance, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, nil
+	}
+	if out, err := runGit(ctx, dir, "rev-parse", "--is-inside-work-tree"); err != nil || out != "true" {
+		return nil, nil
+	}
+
+	provenance := &SourceProvenance{}
+	// rev-parse HEAD fails in a repository without commits.
+	hasCommits := true
+	if commit, err := runGit(ctx, dir, "rev-parse", "HEAD"); err == nil {
+		provenance.Commit = commit
+	} else {
+		hasCommits = false
+	}
+	if branch, err := runGit(ctx, dir, "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		provenance.Branch = branch
+	}
+	status, err := runGit(ctx, dir, "status", "--porcelain", "--", ".")
+	if err != nil {
+		return nil, fmt.Errorf("git status: %w", err)
+	}
+	provenance.Dirty = status != ""
+	// Untracked files do not show up in the diff stat; fall back to the
+	// status listing for them.
+	if provenance.Dirty {
+		provenance.DiffStat = status
+	}
+	if provenance.Dirty && hasCommits {
+		stat, err := runGit(ctx, dir, "diff", "--stat", "HEAD", "--", ".")
+		if err != nil {
+			return nil, fmt.Errorf("git diff: %w", err)
+		}
+		if stat != "" {
+			provenance.DiffStat = stat
+		}
+	}
+	return provenance, nil
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// prepareSourceProvenance detects the git state of BuildSourceDir and
+// enforces REQUIRE_CLEAN_SOURCE.
+func prepareSourceProvenance(ctx context.Context, cfg Config) (*SourceProvenance, error) {
+	provenance, err := detectSourceProvenance(ctx, cfg.BuildSourceDir)
+	if err != nil {
+		return nil, err
+	}
+	if provenance == nil {
+		if cfg.RequireCleanSource {
+			return nil, fmt.Errorf("REQUIRE_CLEAN_SOURCE is set but BUILD_SOURCE_DIR is not a git repository")
+		}
+		slog.Info("source directory is not a git repository, no provenance recorded")
+		return nil, nil
+	}
+	slog.Info("source provenance", "commit", provenance.Commit, "branch", provenance.Branch, "dirty", provenance.Dirty)
+	if provenance.Dirty {
+		if cfg.RequireCleanSource {
+			return nil, fmt.Errorf("REQUIRE_CLEAN_SOURCE is set but BUILD_SOURCE_DIR has uncommitted changes:\n%s", provenance.DiffStat)
+		}
+		slog.Warn("building from a source directory with uncommitted changes", "diff_stat", provenance.DiffStat)
+	}
+	return provenance, nil
+}
+
+// provenanceFiles returns the provenance file to add to the source archive.
+func provenanceFiles(provenance *SourceProvenance) (map[string][]byte, error) {
+	if provenance == nil {
+		return nil, nil
+	}
+	data, err := json.MarshalIndent(provenance, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal source provenance: %w", err)
+	}
+	return map[string][]byte{provenanceFileName: append(data, '\n')}, nil
+}
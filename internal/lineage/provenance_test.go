@@ -0,0 +1,85 @@
+package lineage
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gitForTest(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+}
+
+func TestDetectSourceProvenance(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	source := filepath.Join(repo, "build")
+	if err := os.MkdirAll(source, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "docker-compose.yml"), []byte("services: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitForTest(t, repo, "init", "-q", "-b", "main")
+	gitForTest(t, repo, "add", ".")
+	gitForTest(t, repo, "commit", "-q", "-m", "initial")
+
+	provenance, err := detectSourceProvenance(context.Background(), source)
+	if err != nil {
+		t.Fatalf("detect: %v", err)
+	}
+	if provenance == nil || len(provenance.Commit) != 40 || provenance.Branch != "main" || provenance.Dirty {
+		t.Fatalf("unexpected clean provenance %+v", provenance)
+	}
+
+	// Changes outside BuildSourceDir do not make it dirty.
+	if err := os.WriteFile(filepath.Join(repo, "README"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if provenance, _ = detectSourceProvenance(context.Background(), source); provenance.Dirty {
+		t.Errorf("expected changes outside the source directory to be ignored")
+	}
+
+	if err := os.WriteFile(filepath.Join(source, "docker-compose.yml"), []byte("services:\n  build: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	provenance, err = detectSourceProvenance(context.Background(), source)
+	if err != nil {
+		t.Fatalf("detect: %v", err)
+	}
+	if !provenance.Dirty || !strings.Contains(provenance.DiffStat, "docker-compose.yml") {
+		t.Errorf("expected dirty provenance with diff stat, got %+v", provenance)
+	}
+	if !strings.HasSuffix(provenance.String(), " (dirty)") || !strings.HasPrefix(provenance.String(), "main@") {
+		t.Errorf("unexpected String() %q", provenance.String())
+	}
+
+	cfg := Config{BuildSourceDir: source, RequireCleanSource: true}
+	if _, err := prepareSourceProvenance(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "docker-compose.yml") {
+		t.Errorf("expected REQUIRE_CLEAN_SOURCE to refuse the dirty tree, got %v", err)
+	}
+}
+
+func TestPrepareSourceProvenanceWithoutGit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	provenance, err := prepareSourceProvenance(context.Background(), Config{BuildSourceDir: dir})
+	if err != nil || provenance != nil {
+		t.Errorf("expected no provenance outside a repository, got %+v %v", provenance, err)
+	}
+	if _, err := prepareSourceProvenance(context.Background(), Config{BuildSourceDir: dir, RequireCleanSource: true}); err == nil {
+		t.Errorf("expected REQUIRE_CLEAN_SOURCE to refuse a directory without git")
+	}
+}
@@ -0,0 +1,202 @@
+package lineage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Container runtimes that run the compose project on the server.
+const (
+	// RuntimeDocker installs Docker and runs docker compose.
+	RuntimeDocker = "docker"
+	// RuntimePodman installs Podman and runs podman-compose.
+	RuntimePodman = "podman"
+	// RuntimeAuto installs Docker and falls back to Podman when that fails.
+	RuntimeAuto = "auto"
+)
+
+// runtimeMarker prefixes the line the provisioning script reports the
+// selected runtime on.
+const runtimeMarker = "runtime="
+
+// provisionCommand returns the remote command that detects the server OS
+// from /etc/os-release and makes docker compose or podman-compose available.
+// Its last output line is runtimeMarker followed by the selected runtime.
+func (d dockerInstaller) provisionCommand() string {
+	return remoteScript(d.environment(), provisionScript())
+}
+
+// provisionScript dispatches on the OS family and install method. The
+// Docker installation runs in a subshell so CONTAINER_RUNTIME=auto can fall
+// back to Podman when it fails.
+func provisionScript() string {
+	return strings.TrimSpace(`
+if [ "$CONTAINER_RUNTIME" != podman ] && command -v docker >/dev/null 2>&1 && docker compose version >/dev/null 2>&1; then
+  echo 'docker and the compose plugin are already installed'
+  echo "` + runtimeMarker + `docker"
+  exit 0
+fi
+if [ "$CONTAINER_RUNTIME" != docker ] && command -v podman-compose >/dev/null 2>&1; then
+  if [ "$CONTAINER_RUNTIME" = podman ] || ! command -v docker >/dev/null 2>&1; then
+    echo 'podman-compose is already installed'
+    echo "` + runtimeMarker + `podman"
+    exit 0
+  fi
+fi
+if [ "$(id -u)" -ne 0 ]; then
+  echo 'root privileges are required to install Docker; ensure the build server runs as root' >&2
+  exit 1
+fi
+` + osFamilyCommand() + `
+echo "detected ${PRETTY_NAME:-$ID} (family $family)"
+runtime=docker
+if [ "$CONTAINER_RUNTIME" = podman ]; then
+  runtime=podman
+else
+  set +e
+  (
+    set -e
+    case "$DOCKER_INSTALL_METHOD/$family" in
+      static/*)
+` + dockerStaticInstallCommand() + `
+        ;;
+      repo/debian)
+` + dockerAptInstallCommand() + `
+        ;;
+      repo/fedora|repo/rhel|script/rhel)
+` + dockerDnfInstallCommand() + `
+        ;;
+      */suse)
+` + dockerZypperInstallCommand() + `
+        ;;
+      *)
+` + dockerInstallCommand() + `
+        ;;
+    esac
+    docker compose version
+  )
+  status=$?
+  set -e
+  if [ "$status" -ne 0 ]; then
+    if [ "$CONTAINER_RUNTIME" != auto ]; then
+      exit "$status"
+    fi
+    echo "Docker installation failed on $ID; falling back to Podman" >&2
+    runtime=podman
+  fi
+fi
+if [ "$runtime" = podman ]; then
+  if ! command -v podman-compose >/dev/null 2>&1; then
+` + podmanInstallCommand() + `
+  fi
+  podman-compose version
+fi
+echo "` + runtimeMarker + `$runtime"`)
+}
+
+// osFamilyCommand reads /etc/os-release and sets ID and family to debian,
+// fedora, rhel or suse. It exits on an unsupported OS.
+func osFamilyCommand() string {
+	return strings.TrimSpace(`
+if [ ! -r /etc/os-release ]; then
+  echo 'cannot detect the server OS: /etc/os-release is missing' >&2
+  exit 1
+fi
+. /etc/os-release
+ID=${ID:-unknown}
+case "$ID" in
+  ubuntu|debian) family=debian ;;
+  fedora) family=fedora ;;
+  rocky|almalinux|centos|rhel) family=rhel ;;
+  opensuse-leap|opensuse-tumbleweed|sles) family=suse ;;
+  *)
+    echo "unsupported server OS ${PRETTY_NAME:-$ID} (ID=$ID); supported: Ubuntu, Debian, Fedora, Rocky Linux, AlmaLinux, CentOS Stream, RHEL, openSUSE Leap, openSUSE Tumbleweed and SLES" >&2
+    exit 1
+    ;;
+esac`)
+}
+
+// podmanInstallCommand installs Podman and podman-compose from the
+// distribution repositories; on RHEL-compatible systems podman-compose comes
+// from EPEL.
+func podmanInstallCommand() string {
+	return strings.TrimSpace(`
+case "$family" in
+  debian)
+    export DEBIAN_FRONTEND=noninteractive
+    apt-get update -qq
+    apt-get install -y -qq podman podman-compose
+    ;;
+  fedora)
+    dnf -y -q install podman podman-compose
+    ;;
+  rhel)
+    dnf -y -q install epel-release
+    dnf -y -q install podman podman-compose
+    ;;
+  suse)
+    zypper -n -q install podman podman-compose
+    ;;
+esac`)
+}
+
+// parseRuntime returns the runtime reported on the last runtimeMarker line
+// of the provisioning output.
+func parseRuntime(output string) (string, error) {
+	runtime, ok := markerValue(output, runtimeMarker)
+	if !ok {
+		return "", fmt.Errorf("provisioning did not report a container runtime")
+	}
+	switch runtime {
+	case RuntimeDocker, RuntimePodman:
+		return runtime, nil
+	default:
+		return "", fmt.Errorf("unknown container runtime %q", runtime)
+	}
+}
+
+// provision makes a container runtime available on the server and selects
+// the compose command the remaining steps use.
+func (b *Builder) provision(ctx context.Context) error {
+	b.setPhase(logPhaseDockerInstall)
+	if err := b.docker.upload(ctx, b.ssh); err != nil {
+		return err
+	}
+	output, err := b.runCommandOutput(ctx, b.docker.provisionCommand())
+	if err != nil {
+		return err
+	}
+	runtime, err := parseRuntime(output)
+	if err != nil {
+		return err
+	}
+	b.runtime = runtime
+	return b.configureDockerDaemon(ctx)
+}
+
+// containerEngine returns the container CLI of the selected runtime.
+func (b *Builder) containerEngine() string {
+	if b.runtime == RuntimePodman {
+		return "podman"
+	}
+	return "docker"
+}
+
+// composePSQuiet returns the ps arguments that list the IDs of every
+// container of the project, including exited ones. podman-compose always
+// includes exited containers and has no --all flag.
+func (b *Builder) composePSQuiet() string {
+	if b.runtime == RuntimePodman {
+		return "ps -q"
+	}
+	return "ps -a -q"
+}
+
+// composeCommand returns the compose CLI of the selected runtime.
+func (b *Builder) composeCommand() string {
+	if b.runtime == RuntimePodman {
+		return "podman-compose"
+	}
+	return "docker compose"
+}
@@ -0,0 +1,118 @@
+package lineage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// registrySettings holds the registry credentials, mirrors and pull retry
+// settings of a Builder.
+type registrySettings struct {
+	server         string
+	username       string
+	password       string
+	mirrors        []string
+	pullAttempts   int
+	pullRetryDelay int
+}
+
+func newRegistrySettings(cfg Config) registrySettings {
+	attempts := cfg.PullRetries
+	if attempts < 1 {
+		attempts = 1
+	}
+	return registrySettings{
+		server:         cfg.RegistryServer,
+		username:       cfg.RegistryUsername,
+		password:       cfg.RegistryPassword,
+		mirrors:        cfg.RegistryMirrors,
+		pullAttempts:   attempts,
+		pullRetryDelay: cfg.PullRetryDelaySeconds,
+	}
+}
+
+// validateRegistry checks the registry settings of cfg.
+func validateRegistry(cfg Config) error {
+	if (cfg.RegistryUsername == "") != (cfg.RegistryPassword == "") {
+		return fmt.Errorf("REGISTRY_USERNAME and REGISTRY_PASSWORD must be set together")
+	}
+	// Podman has no default registry to log in to.
+	if cfg.RegistryUsername != "" && cfg.RegistryServer == "" && cfg.ContainerRuntime != RuntimeDocker {
+		return fmt.Errorf("REGISTRY_SERVER is required with registry credentials when CONTAINER_RUNTIME is %s", cfg.ContainerRuntime)
+	}
+	for _, mirror := range cfg.RegistryMirrors {
+		if !strings.HasPrefix(mirror, "https://") && !strings.HasPrefix(mirror, "http://") {
+			return fmt.Errorf("REGISTRY_MIRRORS entry %q must be an http:// or https:// URL", mirror)
+		}
+	}
+	if cfg.PullRetries < 1 {
+		return fmt.Errorf("PULL_RETRIES must be at least 1")
+	}
+	if cfg.PullRetryDelaySeconds < 0 {
+		return fmt.Errorf("PULL_RETRY_DELAY_SECONDS must not be negative")
+	}
+	return nil
+}
+
+// loginCommand returns the remote login command. The password is read from
+// stdin so it never appears on a command line or in the logs.
+func (r registrySettings) loginCommand(engine string) string {
+	command := fmt.Sprintf("%s login --username %s --password-stdin", engine, shellQuote(r.username))
+	if r.server != "" {
+		command += " " + shellQuote(r.server)
+	}
+	return command
+}
+
+// logoutCommand returns the remote command that removes the stored
+// credentials again.
+func (r registrySettings) logoutCommand(engine string) string {
+	command := engine + " logout"
+	if r.server != "" {
+		command += " " + shellQuote(r.server)
+	}
+	return command
+}
+
+// pullCommand retries compose pull with exponential backoff, starting at
+// pullRetryDelay seconds.
+func (r registrySettings) pullCommand(compose string) string {
+	return fmt.Sprintf(`for attempt in $(seq 1 %[2]d); do
+  if %[1]s pull; then
+    break
+  fi
+  if [ "$attempt" -eq %[2]d ]; then
+    echo "compose pull failed after %[2]d attempt(s)" >&2
+    exit 1
+  fi
+  delay=$((%[3]d << (attempt - 1)))
+  echo "compose pull failed (attempt $attempt/%[2]d), retrying in ${delay}s" >&2
+  sleep "$delay"
+done`, compose, r.pullAttempts, r.pullRetryDelay)
+}
+
+// registryLogin logs the server in to the configured registry. It returns
+// whether credentials were stored.
+func (b *Builder) registryLogin(ctx context.Context) (bool, error) {
+	if b.registry.username == "" {
+		return false, nil
+	}
+	if err := b.runCommandWithInput(ctx, b.registry.loginCommand(b.containerEngine()), strings.NewReader(b.registry.password)); err != nil {
+		return false, fmt.Errorf("registry login: %w", err)
+	}
+	return true, nil
+}
+
+// registryLogout removes the credentials stored by registryLogin, so a
+// reused server does not keep them. It uses a fresh context so the logout
+// still runs after the build was cancelled or timed out.
+func (b *Builder) registryLogout() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := b.runCommand(ctx, b.registry.logoutCommand(b.containerEngine())); err != nil {
+		slog.Warn("registry logout failed, credentials may remain on the server", "error", err)
+	}
+}
@@ -0,0 +1,97 @@
+package lineage
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistryLoginCommand(t *testing.T) {
+	t.Parallel()
+
+	registry := newRegistrySettings(Config{RegistryServer: "ghcr.io", RegistryUsername: "bot", RegistryPassword: "hunter2"})
+	login := registry.loginCommand("docker")
+	if login != "docker login --username 'bot' --password-stdin 'ghcr.io'" {
+		t.Errorf("unexpected login command %q", login)
+	}
+	if strings.Contains(login, "hunter2") {
+		t.Errorf("login command must not contain the password")
+	}
+	if logout := registry.logoutCommand("podman"); logout != "podman logout 'ghcr.io'" {
+		t.Errorf("unexpected logout command %q", logout)
+	}
+}
+
+func TestValidateRegistry(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []Config{
+		{RegistryUsername: "bot", PullRetries: 1},
+		{RegistryMirrors: []string{"mirror.gcr.io"}, PullRetries: 1},
+		{PullRetries: 0},
+		{PullRetries: 1, PullRetryDelaySeconds: -1},
+		{RegistryUsername: "bot", RegistryPassword: "secret", ContainerRuntime: RuntimePodman, PullRetries: 1},
+		{RegistryUsername: "bot", RegistryPassword: "secret", ContainerRuntime: RuntimeAuto, PullRetries: 1},
+	} {
+		if err := validateRegistry(cfg); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+	if err := validateRegistry(Config{RegistryMirrors: []string{"https://mirror.gcr.io"}, PullRetries: 3}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := validateRegistry(Config{RegistryUsername: "bot", RegistryPassword: "secret", ContainerRuntime: RuntimeDocker, PullRetries: 1}); err != nil {
+		t.Errorf("expected Docker Hub login without REGISTRY_SERVER, got %v", err)
+	}
+	if err := validateRegistry(Config{RegistryServer: "ghcr.io", RegistryUsername: "bot", RegistryPassword: "secret", ContainerRuntime: RuntimePodman, PullRetries: 1}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestPullCommandRetries(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	// A stub docker whose pull fails until it has been called three times.
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "count")
+	stub := `#!/bin/sh
+n=$(($(cat ` + shellQuote(counter) + ` 2>/dev/null || echo 0) + 1))
+echo "$n" > ` + shellQuote(counter) + `
+[ "$n" -ge 3 ]
+`
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(stub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	env := append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for attempts, wantErr := range map[int]bool{2: true, 3: false} {
+		if err := os.Remove(counter); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		registry := registrySettings{pullAttempts: attempts}
+		cmd := exec.Command("bash", "-c", remoteScript(registry.pullCommand("docker compose")))
+		cmd.Env = env
+		output, err := cmd.CombinedOutput()
+		if (err != nil) != wantErr {
+			t.Errorf("%d attempts: unexpected result %v\n%s", attempts, err, output)
+		}
+	}
+}
+
+func TestDaemonSettingsIncludeMirrors(t *testing.T) {
+	t.Parallel()
+
+	builder := NewBuilder(&SSHClient{}, Config{RegistryMirrors: []string{"https://mirror.gcr.io"}})
+	merged, changed, err := mergeDaemonConfig(`{"data-root": "/data"}`, builder.daemonSettings())
+	if err != nil || !changed {
+		t.Fatalf("mergeDaemonConfig: changed=%v err=%v", changed, err)
+	}
+	if !strings.Contains(string(merged), `"registry-mirrors": [`) || !strings.Contains(string(merged), `"data-root": "/data"`) {
+		t.Errorf("unexpected daemon.json %s", merged)
+	}
+}
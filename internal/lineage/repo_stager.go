@@ -1,20 +1,19 @@
 package lineage
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
-func PrepareRepositoryArchive(ctx context.Context, cfg Config) (string, func(), error) {
-	if cfg.BuildSourceDir == "" {
-		return "", nil, fmt.Errorf("BUILD_SOURCE_DIR is required")
-	}
+// PrepareRepositoryArchive archives BuildSourceDir into LocalArtifactDir,
+// with the provenance file when the source is a git repository.
+func PrepareRepositoryArchive(ctx context.Context, cfg Config, provenance *SourceProvenance) (string, func(), error) {
 	baseDir := cfg.LocalArtifactDir
 	if baseDir == "" {
 		baseDir = os.TempDir()
@@ -22,84 +21,140 @@ func PrepareRepositoryArchive(ctx context.Context, cfg Config) (string, func(),
 	if err := os.MkdirAll(baseDir, 0o755); err != nil {
 		return "", nil, fmt.Errorf("create local artifact dir: %w", err)
 	}
-	stagingDir, err := os.MkdirTemp(baseDir, "repo-staging-")
-	if err != nil {
-		return "", nil, fmt.Errorf("create staging dir: %w", err)
-	}
 	suffix, err := randomSuffix()
 	if err != nil {
-		_ = os.RemoveAll(stagingDir)
 		return "", nil, err
 	}
-	archivePath := filepath.Join(baseDir, fmt.Sprintf("lineage-repo-%s.tar.gz", suffix))
+	archivePath := filepath.Join(baseDir, fmt.Sprintf("lineage-repo-%s%s", suffix, archiveExtension(cfg.SourceCompression)))
 	cleanup := func() {
-		_ = os.RemoveAll(stagingDir)
 		_ = os.Remove(archivePath)
 	}
 
-	// [DIAGNOSE] 复制前：打印 sourceDir 内容
-	log.Printf("[DIAGNOSE] Pre-copy: listing sourceDir=%s", cfg.BuildSourceDir)
-	if listErr := listDirectory(ctx, cfg.BuildSourceDir); listErr != nil {
-		log.Printf("[DIAGNOSE] Warning: failed to list sourceDir: %v", listErr)
-	}
-
-	if err := stageSourceDirectory(ctx, cfg.BuildSourceDir, stagingDir); err != nil {
-		cleanup()
+	matcher, err := prepareSourceMatcher(ctx, cfg)
+	if err != nil {
 		return "", nil, err
 	}
-
-	// [DIAGNOSE] 复制后：打印 dest 内容
-	log.Printf("[DIAGNOSE] Post-copy: listing stagingDir=%s", stagingDir)
-	if listErr := listDirectory(ctx, stagingDir); listErr != nil {
-		log.Printf("[DIAGNOSE] Warning: failed to list stagingDir: %v", listErr)
+	extra, err := provenanceFiles(provenance)
+	if err != nil {
+		return "", nil, err
 	}
+	slog.Debug("[DIAGNOSE] Pre-archive: creating archive", "archive", archivePath, "compression", cfg.SourceCompression)
 
-	// [DIAGNOSE] 压缩前：打印即将打包的路径
-	log.Printf("[DIAGNOSE] Pre-archive: creating tar.gz from stagingDir=%s to archivePath=%s", stagingDir, archivePath)
-
-	if err := createRepoArchive(ctx, stagingDir, archivePath); err != nil {
+	stats, err := createRepoArchive(ctx, cfg.BuildSourceDir, archivePath, matcher, cfg.SourceCompression, cfg.SourceCompressionLevel, extra)
+	if err != nil {
 		cleanup()
 		return "", nil, err
 	}
 
-	// [DIAGNOSE] 压缩后：打印 archive 文件大小和内容列表
-	log.Printf("[DIAGNOSE] Post-archive: checking archive=%s", archivePath)
-	if statErr := statFile(archivePath); statErr != nil {
-		log.Printf("[DIAGNOSE] Warning: failed to stat archive: %v", statErr)
+	if info, statErr := os.Stat(archivePath); statErr == nil {
+		slog.Info("source archive created",
+			"path", archivePath,
+			"size", formatBytes(info.Size()),
+			"files", stats.files,
+			"uncompressed", formatBytes(stats.size),
+			"compression", cfg.SourceCompression,
+			"excluded", stats.excluded)
 	}
-	if listErr := listTarContents(ctx, archivePath); listErr != nil {
-		log.Printf("[DIAGNOSE] Warning: failed to list tar contents: %v", listErr)
+	if len(stats.entries) > 0 {
+		// [DIAGNOSE] 打包后：打印 archive 内容列表
+		slog.Debug("[DIAGNOSE] Archive contents", "contents", strings.Join(stats.entries, "\n"))
 	}
 
 	return archivePath, cleanup, nil
 }
 
-func createRepoArchive(ctx context.Context, sourceDir, archivePath string) error {
-	return runLocalCommand(ctx, "tar", "-czf", archivePath, "-C", sourceDir, ".")
-}
+// prepareSourceMatcher loads the exclude rules for BuildSourceDir, logs a
+// summary of the directory about to be archived and scans it for secrets.
+func prepareSourceMatcher(ctx context.Context, cfg Config) (*excludeMatcher, error) {
+	if cfg.BuildSourceDir == "" {
+		return nil, fmt.Errorf("BUILD_SOURCE_DIR is required")
+	}
+	if _, err := os.Stat(cfg.BuildSourceDir); err != nil {
+		return nil, fmt.Errorf("check BUILD_SOURCE_DIR: %w", err)
+	}
+	patterns, err := loadSourceExcludes(cfg.BuildSourceDir, cfg.SourceExcludes)
+	if err != nil {
+		return nil, err
+	}
+	// Never archive the artifact directory (and the archive being written)
+	// when it lives inside the source directory.
+	artifactDir := cfg.LocalArtifactDir
+	if artifactDir == "" {
+		artifactDir = os.TempDir()
+	}
+	if rel, ok := relativeSubdir(cfg.BuildSourceDir, artifactDir); ok {
+		patterns = append(patterns, "/"+rel+"/")
+	}
+	// The server state file holds the SSH private key with REUSE_SERVER and
+	// defaults to the working directory, which may be the source directory.
+	if cfg.ServerStatePath != "" {
+		if rel, ok := relativeSubdir(cfg.BuildSourceDir, cfg.ServerStatePath); ok {
+			patterns = append(patterns, "/"+rel)
+		}
+	}
+
+	if summary, summaryErr := summarizeDirectory(cfg.BuildSourceDir, sourceSummaryTopN); summaryErr != nil {
+		slog.Warn("failed to summarize source directory", "path", cfg.BuildSourceDir, "error", summaryErr)
+	} else {
+		summary.log(cfg.BuildSourceDir)
+	}
 
-func runLocalCommand(ctx context.Context, name string, args ...string) error {
-	cmd := exec.CommandContext(ctx, name, args...)
-	var output bytes.Buffer
-	cmd.Stdout = &output
-	cmd.Stderr = &output
-	if err := cmd.Run(); err != nil {
-		message := strings.TrimSpace(output.String())
-		if message != "" {
-			return fmt.Errorf("%s failed: %w: %s", name, err, message)
+	if debugEnabled() {
+		// [DIAGNOSE] 打包前：打印 sourceDir 内容
+		slog.Debug("[DIAGNOSE] Pre-archive: listing sourceDir", "path", cfg.BuildSourceDir, "excludes", strings.Join(patterns, ","))
+		if listErr := listDirectory(ctx, cfg.BuildSourceDir); listErr != nil {
+			slog.Debug("[DIAGNOSE] failed to list sourceDir", "error", listErr)
 		}
-		return fmt.Errorf("%s failed: %w", name, err)
 	}
-	return nil
+	matcher := newExcludeMatcher(patterns)
+	if err := checkSourceSecrets(ctx, cfg, matcher); err != nil {
+		return nil, err
+	}
+	return matcher, nil
 }
 
-func stageSourceDirectory(ctx context.Context, sourceDir, dest string) error {
-	if _, err := os.Stat(sourceDir); err != nil {
-		return fmt.Errorf("check BUILD_SOURCE_DIR: %w", err)
+// createRepoArchive writes the source directory and the extra files to
+// archivePath as a tar archive with the given compression.
+func createRepoArchive(ctx context.Context, sourceDir, archivePath string, matcher *excludeMatcher, compression string, level int, extra map[string][]byte) (sourceArchiveStats, error) {
+	file, err := os.OpenFile(filepath.Clean(archivePath), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return sourceArchiveStats{}, fmt.Errorf("create source archive: %w", err)
+	}
+	defer file.Close()
+
+	compressor, err := newCompressWriter(file, compression, level)
+	if err != nil {
+		return sourceArchiveStats{}, err
+	}
+	stats, err := writeSourceTar(ctx, sourceDir, compressor, matcher, nil, extra)
+	if err != nil {
+		return stats, fmt.Errorf("archive source directory: %w", err)
 	}
-	// 使用 -T 选项避免创建多余的子目录
-	// cp -aT 会把 sourceDir 的内容复制到 dest，不会在 dest 下创建 sourceDir 的子目录
-	return runLocalCommand(ctx, "cp", "-aT", sourceDir, dest)
+	if err := compressor.Close(); err != nil {
+		return stats, fmt.Errorf("finish source archive: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return stats, fmt.Errorf("close source archive: %w", err)
+	}
+	return stats, nil
+}
+
+// relativeSubdir returns dir relative to root, slash-separated, when dir is
+// strictly inside root.
+func relativeSubdir(root, dir string) (string, bool) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absRoot, absDir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
 }
 
 // [DIAGNOSE] listDirectory 打印目录的文件列表
@@ -109,34 +164,84 @@ func listDirectory(ctx context.Context, dir string) error {
 	if err != nil {
 		return err
 	}
-	log.Printf("[DIAGNOSE] Directory listing of %s:\n%s", dir, string(output))
+	slog.Debug("[DIAGNOSE] Directory listing", "path", dir, "listing", string(output))
 
 	// 同时打印 find 结果查看完整树形结构
 	cmd2 := exec.CommandContext(ctx, "find", dir, "-type", "f")
 	output2, err2 := cmd2.CombinedOutput()
 	if err2 == nil {
-		log.Printf("[DIAGNOSE] File tree of %s:\n%s", dir, string(output2))
+		slog.Debug("[DIAGNOSE] File tree", "path", dir, "files", string(output2))
 	}
 	return nil
 }
 
-// [DIAGNOSE] statFile 打印文件信息
-func statFile(path string) error {
-	info, err := os.Stat(path)
-	if err != nil {
-		return err
+// sourceSummaryTopN is how many of the largest files are listed in the
+// source directory summary.
+const sourceSummaryTopN = 5
+
+type sizedFile struct {
+	path string
+	size int64
+}
+
+// directorySummary is a bounded description of a directory tree, logged at
+// info level instead of full listings.
+type directorySummary struct {
+	files     int
+	totalSize int64
+	largest   []sizedFile
+}
+
+// summarizeDirectory counts the regular files below dir, sums their sizes and
+// keeps the topN largest.
+func summarizeDirectory(dir string, topN int) (directorySummary, error) {
+	var summary directorySummary
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		summary.files++
+		summary.totalSize += info.Size()
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = path
+		}
+		summary.largest = append(summary.largest, sizedFile{path: rel, size: info.Size()})
+		sort.Slice(summary.largest, func(i, j int) bool {
+			return summary.largest[i].size > summary.largest[j].size
+		})
+		if len(summary.largest) > topN {
+			summary.largest = summary.largest[:topN]
+		}
+		return nil
+	})
+	return summary, err
+}
+
+func (s directorySummary) log(dir string) {
+	slog.Info("source directory summary", "path", dir, "files", s.files, "total_size", formatBytes(s.totalSize))
+	for _, file := range s.largest {
+		slog.Info("large source file", "path", file.path, "size", formatBytes(file.size))
 	}
-	log.Printf("[DIAGNOSE] Archive file: path=%s, size=%d bytes", path, info.Size())
-	return nil
 }
 
-// [DIAGNOSE] listTarContents 打印 tar.gz 内容列表
-func listTarContents(ctx context.Context, archivePath string) error {
-	cmd := exec.CommandContext(ctx, "tar", "-tzf", archivePath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return err
+// formatBytes renders a byte count with a binary unit, e.g. 1.5 GiB.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
 	}
-	log.Printf("[DIAGNOSE] Archive contents:\n%s", string(output))
-	return nil
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
 }
@@ -0,0 +1,83 @@
+package lineage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummarizeDirectory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	files := map[string]int{
+		"docker-compose.yml":             100,
+		"manifests/local.xml":            2048,
+		"userscripts/before.sh":          10,
+		"vendor/blobs/proprietary.tar":   4096,
+		"vendor/blobs/proprietary-2.tar": 3000,
+	}
+	for name, size := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := summarizeDirectory(dir, 2)
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	if summary.files != 5 || summary.totalSize != 9254 {
+		t.Errorf("expected 5 files and 9254 bytes, got %d files and %d bytes", summary.files, summary.totalSize)
+	}
+	if len(summary.largest) != 2 || summary.largest[0].path != filepath.Join("vendor", "blobs", "proprietary.tar") {
+		t.Errorf("unexpected largest files %+v", summary.largest)
+	}
+}
+
+func TestPrepareSourceMatcherExcludesServerState(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, defaultServerStatePath)
+	if err := os.WriteFile(statePath, []byte(`{"ssh_private_key":"secret"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		BuildSourceDir:   dir,
+		LocalArtifactDir: t.TempDir(),
+		ServerStatePath:  statePath,
+		SecretScanPolicy: SecretScanOff,
+	}
+	matcher, err := prepareSourceMatcher(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("prepare source matcher: %v", err)
+	}
+	if !matcher.excluded(defaultServerStatePath, false) {
+		t.Errorf("expected %s to be excluded", defaultServerStatePath)
+	}
+	if matcher.excluded("docker-compose.yml", false) {
+		t.Errorf("expected docker-compose.yml to be kept")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	cases := map[int64]string{
+		512:             "512 B",
+		1536:            "1.5 KiB",
+		3 * 1024 * 1024: "3.0 MiB",
+		5 << 30:         "5.0 GiB",
+	}
+	for size, expected := range cases {
+		if got := formatBytes(size); got != expected {
+			t.Errorf("formatBytes(%d) = %q, expected %q", size, got, expected)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package lineage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	runOutcomeSuccess = "success"
+	runOutcomeFailure = "failure"
+
+	runSummaryFileName = "run-summary.json"
+)
+
+// RunSummary describes the outcome of one orchestrator run. It is logged at
+// the end of every run and written to LocalArtifactDir as the run manifest.
+type RunSummary struct {
+	RunID         string            `json:"run_id"`
+	Outcome       string            `json:"outcome"`
+	Error         string            `json:"error,omitempty"`
+	FailureReason *FailureReason    `json:"failure_reason,omitempty"`
+	LikelyCause   string            `json:"likely_cause,omitempty"`
+	ServerID      int64             `json:"server_id,omitempty"`
+	ServerName    string            `json:"server_name,omitempty"`
+	Source        *SourceProvenance `json:"source,omitempty"`
+	ExitCode      *int              `json:"exit_code,omitempty"`
+	Artifacts     []string          `json:"artifacts,omitempty"`
+	Phases        []PhaseTiming     `json:"phases,omitempty"`
+	Cost          *CostReport       `json:"cost,omitempty"`
+	StartedAt     time.Time         `json:"started_at"`
+	FinishedAt    time.Time         `json:"finished_at"`
+}
+
+// PhaseTiming records how long one orchestrator phase took.
+type PhaseTiming struct {
+	Name    string  `json:"name"`
+	Title   string  `json:"title"`
+	Seconds float64 `json:"seconds"`
+}
+
+// Duration returns the wall-clock time of the run.
+func (s *RunSummary) Duration() time.Duration {
+	return s.FinishedAt.Sub(s.StartedAt)
+}
+
+// finish records the outcome of the run from its returned error.
+func (s *RunSummary) finish(err error) {
+	s.FinishedAt = time.Now()
+	if err != nil {
+		s.Outcome = runOutcomeFailure
+		s.Error = err.Error()
+		return
+	}
+	s.Outcome = runOutcomeSuccess
+}
+
+func (s *RunSummary) logSummary() {
+	slog.Info("run summary", "outcome", s.Outcome, "duration", s.Duration().Truncate(time.Second))
+	if s.FailureReason != nil {
+		slog.Info("run summary: failure reason", "category", s.FailureReason.Category, "reason", s.FailureReason.String())
+	}
+	if s.LikelyCause != "" {
+		slog.Info("run summary: diagnostics", "likely_cause", s.LikelyCause)
+	}
+	if s.Source != nil {
+		slog.Info("run summary: source", "commit", s.Source.Commit, "branch", s.Source.Branch, "dirty", s.Source.Dirty)
+	}
+	if s.ExitCode != nil {
+		slog.Info("run summary: build exit code", "exit_code", *s.ExitCode)
+	}
+	if s.Cost != nil {
+		slog.Info("run summary: estimated cost", "cost", s.Cost.String(), "server_lifetime", time.Duration(s.Cost.ServerSeconds*float64(time.Second)).Truncate(time.Second))
+	}
+	for _, artifact := range s.Artifacts {
+		slog.Info("run summary: artifact", "path", artifact)
+	}
+}
+
+// writeRunSummary writes the summary as JSON to dir/run-summary.json.
+func writeRunSummary(dir string, summary *RunSummary) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create artifact dir: %w", err)
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal run summary: %w", err)
+	}
+	path := filepath.Join(dir, runSummaryFileName)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("write run summary: %w", err)
+	}
+	return path, nil
+}
+
+// renderRunSummaryMarkdown renders the summary for the GitHub Actions step
+// summary page.
+func renderRunSummaryMarkdown(s *RunSummary) string {
+	var b strings.Builder
+	status := "✅ succeeded"
+	if s.Outcome != runOutcomeSuccess {
+		status = "❌ failed"
+	}
+	fmt.Fprintf(&b, "## LineageOS build %s\n\n", status)
+	b.WriteString("| | |\n| --- | --- |\n")
+	fmt.Fprintf(&b, "| Duration | %s |\n", s.Duration().Truncate(time.Second))
+	if s.ServerID != 0 {
+		fmt.Fprintf(&b, "| Server | %s (%d) |\n", markdownCell(s.ServerName), s.ServerID)
+	}
+	if s.Source != nil {
+		fmt.Fprintf(&b, "| Source | `%s` |\n", markdownCell(s.Source.String()))
+	}
+	if s.ExitCode != nil {
+		fmt.Fprintf(&b, "| Build exit code | %d |\n", *s.ExitCode)
+	}
+	if s.Cost != nil {
+		fmt.Fprintf(&b, "| Estimated cost | %s |\n", markdownCell(s.Cost.String()))
+		if s.Cost.MaxCost > 0 {
+			fmt.Fprintf(&b, "| Cost ceiling | %.2f %s |\n", s.Cost.MaxCost, s.Cost.Currency)
+		}
+		fmt.Fprintf(&b, "| Traffic | %s in / %s out |\n", formatBytes(int64(s.Cost.IngoingTraffic)), formatBytes(int64(s.Cost.OutgoingTraffic)))
+	}
+	if s.FailureReason != nil {
+		fmt.Fprintf(&b, "| Failure reason | `%s` %s |\n", s.FailureReason.Category, markdownCell(s.FailureReason.String()))
+	}
+	if s.LikelyCause != "" {
+		fmt.Fprintf(&b, "| Diagnostics | %s |\n", markdownCell(s.LikelyCause))
+	}
+	if s.Error != "" && s.FailureReason == nil {
+		fmt.Fprintf(&b, "| Error | %s |\n", markdownCell(s.Error))
+	}
+
+	if len(s.Phases) > 0 {
+		b.WriteString("\n### Phases\n\n| Phase | Duration |\n| --- | --- |\n")
+		for _, phase := range s.Phases {
+			duration := time.Duration(phase.Seconds * float64(time.Second)).Truncate(time.Second)
+			fmt.Fprintf(&b, "| %s | %s |\n", markdownCell(phase.Title), duration)
+		}
+	}
+	if len(s.Artifacts) > 0 {
+		b.WriteString("\n### Artifacts\n\n")
+		for _, artifact := range s.Artifacts {
+			fmt.Fprintf(&b, "- `%s`\n", artifact)
+		}
+	}
+	return b.String()
+}
+
+// markdownCell keeps a value on one line and stops it from breaking the table.
+func markdownCell(value string) string {
+	value = strings.ReplaceAll(value, "\n", " ")
+	return strings.ReplaceAll(value, "|", "\\|")
+}
@@ -0,0 +1,189 @@
+package lineage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Secret scan policies.
+const (
+	SecretScanWarn = "warn"
+	SecretScanFail = "fail"
+	SecretScanOff  = "off"
+)
+
+// secretScanMaxFileSize bounds the files whose contents are scanned. Larger
+// files are prebuilt blobs and images, not configuration.
+const secretScanMaxFileSize = 1 << 20
+
+// secretFinding is one suspicious file. Only the rule is reported, never the
+// matched text.
+type secretFinding struct {
+	Path string
+	Rule string
+	Line int
+}
+
+func (f secretFinding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s:%d (%s)", f.Path, f.Line, f.Rule)
+	}
+	return fmt.Sprintf("%s (%s)", f.Path, f.Rule)
+}
+
+// secretFileRule flags files by name. signingKey rules do not apply inside
+// the signing key directory.
+type secretFileRule struct {
+	name       string
+	patterns   []string
+	signingKey bool
+}
+
+var secretFileRules = []secretFileRule{
+	{name: "environment file", patterns: []string{".env", ".env.*"}},
+	{name: "Java keystore", patterns: []string{"*.jks", "*.keystore"}, signingKey: true},
+	{name: "PKCS#8 private key", patterns: []string{"*.pk8"}, signingKey: true},
+}
+
+type secretContentRule struct {
+	name       string
+	pattern    *regexp.Regexp
+	signingKey bool
+}
+
+var secretContentRules = []secretContentRule{
+	{name: "private key", pattern: regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`), signingKey: true},
+	{name: "GitHub token", pattern: regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{name: "Hetzner token", pattern: regexp.MustCompile(`(?i)(hetzner|hcloud)[A-Z0-9_]*\s*[:=]\s*["']?[A-Za-z0-9]{64}\b`)},
+}
+
+// scanSourceSecrets looks for secrets in the files of sourceDir that would
+// be archived. Key material below signingDir, relative to sourceDir, is
+// expected and not reported.
+func scanSourceSecrets(ctx context.Context, sourceDir string, matcher *excludeMatcher, signingDir string) ([]secretFinding, error) {
+	signingDir = strings.Trim(filepath.ToSlash(filepath.Clean(signingDir)), "/")
+	if signingDir == "." {
+		signingDir = ""
+	}
+	var findings []secretFinding
+	err := filepath.WalkDir(sourceDir, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, filePath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if matcher.excluded(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		inSigningDir := signingDir != "" && (rel == signingDir || strings.HasPrefix(rel, signingDir+"/"))
+
+		for _, rule := range secretFileRules {
+			if rule.signingKey && inSigningDir {
+				continue
+			}
+			for _, pattern := range rule.patterns {
+				if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+					findings = append(findings, secretFinding{Path: rel, Rule: rule.name})
+					return nil
+				}
+			}
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > secretScanMaxFileSize {
+			return nil
+		}
+		finding, err := scanFileContents(filePath, inSigningDir)
+		if err != nil {
+			return fmt.Errorf("scan %s: %w", rel, err)
+		}
+		if finding != nil {
+			finding.Path = rel
+			findings = append(findings, *finding)
+		}
+		return nil
+	})
+	return findings, err
+}
+
+// scanFileContents returns the first content rule matching a text file.
+// Binary files are skipped.
+func scanFileContents(filePath string, inSigningDir bool) (*secretFinding, error) {
+	data, err := os.ReadFile(filepath.Clean(filePath))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return nil, nil
+	}
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for line := 1; ; line++ {
+		text, err := reader.ReadString('\n')
+		for _, rule := range secretContentRules {
+			if rule.signingKey && inSigningDir {
+				continue
+			}
+			if rule.pattern.MatchString(text) {
+				return &secretFinding{Rule: rule.name, Line: line}, nil
+			}
+		}
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// checkSourceSecrets runs the secret scan according to SECRET_SCAN_POLICY.
+func checkSourceSecrets(ctx context.Context, cfg Config, matcher *excludeMatcher) error {
+	if cfg.SecretScanPolicy == SecretScanOff {
+		return nil
+	}
+	findings, err := scanSourceSecrets(ctx, cfg.BuildSourceDir, matcher, cfg.SigningKeysDir)
+	if err != nil {
+		return fmt.Errorf("secret scan: %w", err)
+	}
+	if len(findings) == 0 {
+		slog.Info("secret scan found nothing")
+		return nil
+	}
+	paths := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		slog.Warn("possible secret in source directory", "path", finding.Path, "line", finding.Line, "rule", finding.Rule)
+		paths = append(paths, finding.String())
+	}
+	if cfg.SecretScanPolicy == SecretScanFail {
+		return fmt.Errorf("secret scan found %d file(s); remove them, add them to %s or SOURCE_EXCLUDES, or set SECRET_SCAN_POLICY=warn: %s",
+			len(findings), sourceIgnoreFile, strings.Join(paths, ", "))
+	}
+	return nil
+}
@@ -17,10 +17,14 @@ type ServerState struct {
 	GitHubKeyIDsReused []int64 `json:"github_key_ids_reused,omitempty"`
 	SSHPort            int     `json:"ssh_port"`
 	Datacenter         string  `json:"datacenter"`
+	// SSHPrivateKey is only persisted with REUSE_SERVER so the next run can
+	// connect to the same server.
+	SSHPrivateKey string `json:"ssh_private_key,omitempty"`
 }
 
-// SaveServerState persists server information to a file
-func SaveServerState(path string, server *HetznerServer) error {
+// SaveServerState persists server information to a file. The ephemeral SSH
+// private key is included when includeKey is set.
+func SaveServerState(path string, server *HetznerServer, includeKey bool) error {
 	state := ServerState{
 		ServerID:           server.ID,
 		ServerName:         server.Name,
@@ -31,6 +35,9 @@ func SaveServerState(path string, server *HetznerServer) error {
 		SSHPort:            server.SSHPort,
 		Datacenter:         server.Datacenter,
 	}
+	if includeKey {
+		state.SSHPrivateKey = string(server.SSHKey)
+	}
 
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
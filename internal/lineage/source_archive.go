@@ -0,0 +1,269 @@
+package lineage
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Source transfer modes.
+const (
+	SourceTransferArchive = "archive"
+	SourceTransferStream  = "stream"
+	SourceTransferSync    = "sync"
+)
+
+// sourceIgnoreFile holds .gitignore-style exclude patterns at the root of
+// BuildSourceDir.
+const sourceIgnoreFile = ".lineageignore"
+
+// defaultSourceExcludes is used when SOURCE_EXCLUDES is not set.
+const defaultSourceExcludes = ".git/"
+
+// excludeRule is one .gitignore-style pattern.
+type excludeRule struct {
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	segments []string
+}
+
+// excludeMatcher decides which source paths are left out of the archive.
+// It supports the common .gitignore syntax: comments, "!" negation, a
+// trailing "/" for directories, a leading or inner "/" to anchor a pattern
+// at the source root, and "**" for any number of directories. The last
+// matching pattern wins.
+type excludeMatcher struct {
+	rules []excludeRule
+}
+
+func newExcludeMatcher(patterns []string) *excludeMatcher {
+	m := &excludeMatcher{}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		var rule excludeRule
+		if strings.HasPrefix(pattern, "!") {
+			rule.negate = true
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			rule.dirOnly = true
+			pattern = strings.TrimRight(pattern, "/")
+		}
+		if strings.Contains(pattern, "/") {
+			rule.anchored = true
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+		if pattern == "" {
+			continue
+		}
+		rule.segments = strings.Split(pattern, "/")
+		m.rules = append(m.rules, rule)
+	}
+	return m
+}
+
+// excluded reports whether the slash-separated path rel, relative to the
+// source root, is excluded.
+func (m *excludeMatcher) excluded(rel string, isDir bool) bool {
+	segments := strings.Split(rel, "/")
+	excluded := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		var matched bool
+		if rule.anchored {
+			matched = matchPathSegments(rule.segments, segments)
+		} else {
+			matched = matchPathSegments(rule.segments, segments[len(segments)-1:])
+		}
+		if matched {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+func matchPathSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchPathSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchPathSegments(pattern[1:], name[1:])
+}
+
+// loadSourceExcludes combines the configured exclude list with the
+// .lineageignore file of the source directory.
+func loadSourceExcludes(sourceDir string, configured []string) ([]string, error) {
+	patterns := append([]string{}, configured...)
+	file, err := os.Open(filepath.Join(sourceDir, sourceIgnoreFile))
+	if os.IsNotExist(err) {
+		return patterns, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", sourceIgnoreFile, err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", sourceIgnoreFile, err)
+	}
+	return patterns, nil
+}
+
+// sourceArchiveStats describes what writeSourceTar put in the archive.
+type sourceArchiveStats struct {
+	files    int
+	dirs     int
+	symlinks int
+	excluded int
+	size     int64
+	// entries lists the archived paths; it is only filled at debug level.
+	entries []string
+}
+
+// writeSourceTar writes the contents of sourceDir to w as a tar stream,
+// without the root directory itself. A non-nil include further limits the
+// entries written; directories it rejects are still walked. Like cp -a it
+// keeps symlinks as links and preserves modes, ownership and modification
+// times. Sockets cannot be archived and are skipped. The extra files are
+// appended at the archive root.
+func writeSourceTar(ctx context.Context, sourceDir string, w io.Writer, matcher *excludeMatcher, include func(rel string, isDir bool) bool, extra map[string][]byte) (sourceArchiveStats, error) {
+	var stats sourceArchiveStats
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(sourceDir, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, filePath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if matcher.excluded(rel, entry.IsDir()) {
+			stats.excluded++
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if include != nil && !include(rel, entry.IsDir()) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSocket != 0 {
+			slog.Debug("skipping socket in source directory", "path", rel)
+			return nil
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(filePath); err != nil {
+				return fmt.Errorf("read symlink %s: %w", rel, err)
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("tar header for %s: %w", rel, err)
+		}
+		header.Name = rel
+		if entry.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("write tar header for %s: %w", rel, err)
+		}
+		if debugEnabled() {
+			stats.entries = append(stats.entries, header.Name)
+		}
+
+		switch {
+		case entry.IsDir():
+			stats.dirs++
+		case link != "":
+			stats.symlinks++
+		case info.Mode().IsRegular():
+			stats.files++
+			stats.size += info.Size()
+			if err := copyFileInto(tw, filePath); err != nil {
+				return fmt.Errorf("archive %s: %w", rel, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(extra[name])),
+			ModTime:  time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return stats, fmt.Errorf("write tar header for %s: %w", name, err)
+		}
+		if _, err := tw.Write(extra[name]); err != nil {
+			return stats, fmt.Errorf("archive %s: %w", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return stats, fmt.Errorf("finish tar stream: %w", err)
+	}
+	return stats, nil
+}
+
+func copyFileInto(w io.Writer, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
@@ -0,0 +1,132 @@
+package lineage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExcludeMatcher(t *testing.T) {
+	t.Parallel()
+
+	matcher := newExcludeMatcher([]string{
+		"# comment",
+		".git/",
+		"*.log",
+		"!keep.log",
+		"/out",
+		"cache/**/tmp",
+	})
+	cases := []struct {
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{".git", true, true},
+		{"sub/.git", true, true},
+		{".git", false, false},
+		{"build.log", false, true},
+		{"logs/keep.log", false, false},
+		{"out", true, true},
+		{"sub/out", true, false},
+		{"cache/tmp", true, true},
+		{"cache/a/b/tmp", false, true},
+		{"docker-compose.yml", false, false},
+	}
+	for _, tc := range cases {
+		if got := matcher.excluded(tc.path, tc.isDir); got != tc.excluded {
+			t.Errorf("excluded(%q, dir=%v) = %v, expected %v", tc.path, tc.isDir, got, tc.excluded)
+		}
+	}
+}
+
+func TestWriteSourceTar(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	files := map[string]os.FileMode{
+		"docker-compose.yml":    0o644,
+		"userscripts/before.sh": 0o755,
+		".git/HEAD":             0o644,
+		"artifacts/old.zip":     0o644,
+	}
+	for name, mode := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("userscripts/before.sh", filepath.Join(dir, "before.sh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, sourceIgnoreFile), []byte("artifacts/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	patterns, err := loadSourceExcludes(dir, []string{defaultSourceExcludes})
+	if err != nil {
+		t.Fatalf("load excludes: %v", err)
+	}
+	var buf bytes.Buffer
+	stats, err := writeSourceTar(context.Background(), dir, &buf, newExcludeMatcher(patterns), nil, map[string][]byte{provenanceFileName: []byte("{}")})
+	if err != nil {
+		t.Fatalf("write tar: %v", err)
+	}
+	if stats.excluded != 2 {
+		t.Errorf("expected 2 excluded entries, got %d", stats.excluded)
+	}
+
+	headers := map[string]*tar.Header{}
+	reader := tar.NewReader(&buf)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		headers[header.Name] = header
+	}
+	for _, name := range []string{".git/", ".git/HEAD", "artifacts/", "artifacts/old.zip"} {
+		if _, ok := headers[name]; ok {
+			t.Errorf("expected %s to be excluded", name)
+		}
+	}
+	if header := headers["userscripts/before.sh"]; header == nil || header.FileInfo().Mode().Perm() != 0o755 {
+		t.Errorf("expected executable script to keep its mode, got %+v", header)
+	}
+	if header := headers["before.sh"]; header == nil || header.Typeflag != tar.TypeSymlink || header.Linkname != "userscripts/before.sh" {
+		t.Errorf("expected symlink to be archived as a link, got %+v", header)
+	}
+	if header := headers["userscripts/"]; header == nil || header.Typeflag != tar.TypeDir {
+		t.Errorf("expected directory entry for userscripts/")
+	}
+	if header := headers[provenanceFileName]; header == nil || header.Size != 2 {
+		t.Errorf("expected extra file %s at the archive root, got %+v", provenanceFileName, header)
+	}
+}
+
+func TestRelativeSubdir(t *testing.T) {
+	t.Parallel()
+
+	if rel, ok := relativeSubdir("/src", "/src/artifacts"); !ok || rel != "artifacts" {
+		t.Errorf("expected artifacts, got %q %v", rel, ok)
+	}
+	if _, ok := relativeSubdir("/src", "/tmp/artifacts"); ok {
+		t.Errorf("expected a directory outside the source to be rejected")
+	}
+	if _, ok := relativeSubdir("/src", "/src"); ok {
+		t.Errorf("expected the source directory itself to be rejected")
+	}
+}
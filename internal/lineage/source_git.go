@@ -0,0 +1,148 @@
+package lineage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// scpLikeGitURL matches the user@host:path form accepted by git for SSH.
+var scpLikeGitURL = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/]`)
+
+// isGitURL reports whether source is a remote git URL rather than a path.
+func isGitURL(source string) bool {
+	if scpLikeGitURL.MatchString(source) {
+		return true
+	}
+	parsed, err := url.Parse(source)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	switch parsed.Scheme {
+	case "https", "http", "ssh", "git":
+		return true
+	}
+	return false
+}
+
+// isHTTPGitURL reports whether the git URL authenticates over HTTP, where
+// BUILD_SOURCE_TOKEN can be used.
+func isHTTPGitURL(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// RedactSourceURL hides credentials embedded in a git URL for logging.
+func RedactSourceURL(source string) string {
+	if parsed, err := url.Parse(source); err == nil && parsed.User != nil {
+		return parsed.Redacted()
+	}
+	return source
+}
+
+// sourceURLHasCredentials reports whether the git URL embeds credentials,
+// which would end up in commands, logs and .git/config on the server. The
+// user name of an SSH URL is not a credential.
+func sourceURLHasCredentials(source string) bool {
+	parsed, err := url.Parse(source)
+	if err != nil || parsed.User == nil {
+		return false
+	}
+	if isHTTPGitURL(source) {
+		return true
+	}
+	_, hasPassword := parsed.User.Password()
+	return hasPassword
+}
+
+// authHeaderKey returns the git config key that sends the Authorization
+// header only to the host of repository, so submodules hosted elsewhere
+// never receive the token. It returns "" unless repository uses https://,
+// since the header would otherwise travel in cleartext.
+func authHeaderKey(repository string) string {
+	parsed, err := url.Parse(repository)
+	if err != nil || parsed.Host == "" || parsed.Scheme != "https" {
+		return ""
+	}
+	return fmt.Sprintf("http.%s://%s/.extraHeader", parsed.Scheme, parsed.Host)
+}
+
+// gitCloneScript checks out ref (or the default branch) of repository into
+// workDir with history depth 1 and prints the resulting commit. A token is
+// read from the first line of stdin and sent as an HTTP Authorization header
+// through GIT_CONFIG_* variables, so it shows up neither in the process list
+// nor in .git/config.
+func gitCloneScript(workDir, repository, ref string) string {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	authHeader := ":"
+	if key := authHeaderKey(repository); key != "" {
+		authHeader = fmt.Sprintf(`if [ -n "$token" ]; then export GIT_CONFIG_COUNT=1 GIT_CONFIG_KEY_0=%s GIT_CONFIG_VALUE_0="Authorization: Basic $(printf 'x-access-token:%%s' "$token" | base64 -w0)"; fi`, shellQuote(key))
+	}
+	return remoteScript(
+		"IFS= read -r token || true",
+		authHeader,
+		"unset token",
+		gitInstallCommand(),
+		fmt.Sprintf("rm -rf %s", shellQuote(workDir)),
+		fmt.Sprintf("git init -q %s", shellQuote(workDir)),
+		fmt.Sprintf("cd %s", shellQuote(workDir)),
+		fmt.Sprintf("git remote add origin %s", shellQuote(repository)),
+		fmt.Sprintf("git fetch -q --depth 1 origin %s", shellQuote(ref)),
+		"git checkout -q --detach FETCH_HEAD",
+		"git submodule update -q --init --recursive --depth 1",
+		"git rev-parse HEAD",
+	)
+}
+
+// gitInstallCommand installs git with the package manager of the server OS
+// when it is missing. The clone runs before provisioning, so it cannot rely
+// on anything installed there.
+func gitInstallCommand() string {
+	return `if ! command -v git >/dev/null 2>&1; then
+` + osFamilyCommand() + `
+case "$family" in
+  debian) apt-get update -qq && DEBIAN_FRONTEND=noninteractive apt-get install -y -qq git ;;
+  fedora|rhel) dnf -y -q install git ;;
+  suse) zypper -n -q install git ;;
+esac >&2
+fi`
+}
+
+// CloneSource checks out the git repository straight into the working
+// directory on the server instead of uploading a local directory. It returns
+// the provenance of the checked out commit, which is also written to the
+// working directory like for archived sources.
+func (b *Builder) CloneSource(ctx context.Context, repository, ref, token string) (*SourceProvenance, error) {
+	b.setPhase(logPhaseStaging)
+	command := gitCloneScript(b.workDir, repository, ref)
+	b.appendLog(fmt.Sprintf("%s %s", commandLogPrefix, command))
+	stdout, stderr, err := b.ssh.RunWithInput(ctx, command, strings.NewReader(token+"\n"))
+	b.appendLog(stdout)
+	if stderr != "" {
+		b.appendLog(stderr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("clone %s: %w", RedactSourceURL(repository), err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	commit := strings.TrimSpace(lines[len(lines)-1])
+	if len(commit) != 40 {
+		return nil, fmt.Errorf("clone %s: unexpected commit %q", RedactSourceURL(repository), commit)
+	}
+
+	provenance := &SourceProvenance{Repository: RedactSourceURL(repository), Ref: ref, Commit: commit}
+	files, err := provenanceFiles(provenance)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.ssh.Upload(ctx, b.workDir+"/"+provenanceFileName, bytes.NewReader(files[provenanceFileName]), 0o644); err != nil {
+		return nil, fmt.Errorf("upload source provenance: %w", err)
+	}
+	slog.Info("source cloned", "repository", provenance.Repository, "ref", ref, "commit", commit)
+	return provenance, b.runCommand(ctx, remoteScript(b.stagedSummaryCommand()))
+}
@@ -0,0 +1,288 @@
+package lineage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// syncManifestFile is written to the working directory after every sync and
+// records what the last sync put there.
+const syncManifestFile = ".lineage-sync-manifest"
+
+// Entry types of a sync manifest.
+const (
+	syncEntryFile    = "file"
+	syncEntryDir     = "dir"
+	syncEntrySymlink = "symlink"
+)
+
+type syncEntry struct {
+	Type   string      `json:"type"`
+	Mode   os.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256,omitempty"`
+	Link   string      `json:"link,omitempty"`
+	Size   int64       `json:"size,omitempty"`
+}
+
+// syncManifest maps slash-separated paths relative to the source root to
+// their entry.
+type syncManifest map[string]syncEntry
+
+// buildSyncManifest hashes every file of sourceDir that is not excluded.
+func buildSyncManifest(ctx context.Context, sourceDir string, matcher *excludeMatcher) (syncManifest, error) {
+	manifest := syncManifest{}
+	err := filepath.WalkDir(sourceDir, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, filePath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if matcher.excluded(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			manifest[rel] = syncEntry{Type: syncEntryDir, Mode: info.Mode().Perm()}
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(filePath)
+			if err != nil {
+				return fmt.Errorf("read symlink %s: %w", rel, err)
+			}
+			manifest[rel] = syncEntry{Type: syncEntrySymlink, Link: link}
+		case info.Mode().IsRegular():
+			sum, err := hashFile(filePath)
+			if err != nil {
+				return fmt.Errorf("hash %s: %w", rel, err)
+			}
+			manifest[rel] = syncEntry{Type: syncEntryFile, Mode: info.Mode().Perm(), SHA256: sum, Size: info.Size()}
+		}
+		return nil
+	})
+	return manifest, err
+}
+
+func hashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// syncPlan is what has to change on the server to match the local manifest.
+type syncPlan struct {
+	// upload holds the files and symlinks to send. Directories are always
+	// sent so new ones exist and modes stay current.
+	upload      map[string]bool
+	uploadBytes int64
+	unchanged   int
+	deleteFiles []string
+	// deleteDirs is ordered deepest first so children go before parents.
+	deleteDirs []string
+}
+
+// planSync compares the local manifest with the manifest of the previous
+// sync and the hashes of the files currently on the server. Only paths the
+// previous sync created are deleted, so build outputs in the working
+// directory are left alone.
+func planSync(local, previous syncManifest, remoteHashes map[string]string) syncPlan {
+	plan := syncPlan{upload: map[string]bool{}}
+	for path, entry := range local {
+		switch entry.Type {
+		case syncEntryFile:
+			before, known := previous[path]
+			modeChanged := known && before.Type == syncEntryFile && before.Mode != entry.Mode
+			if remoteHashes[path] == entry.SHA256 && !modeChanged {
+				plan.unchanged++
+				continue
+			}
+			plan.upload[path] = true
+			plan.uploadBytes += entry.Size
+		case syncEntrySymlink:
+			if before, known := previous[path]; known && before == entry {
+				plan.unchanged++
+				continue
+			}
+			plan.upload[path] = true
+		}
+	}
+	for path, entry := range previous {
+		if current, ok := local[path]; ok && current.Type == entry.Type {
+			continue
+		}
+		if entry.Type == syncEntryDir {
+			plan.deleteDirs = append(plan.deleteDirs, path)
+			continue
+		}
+		plan.deleteFiles = append(plan.deleteFiles, path)
+	}
+	sort.Strings(plan.deleteFiles)
+	sort.Slice(plan.deleteDirs, func(i, j int) bool {
+		di, dj := strings.Count(plan.deleteDirs[i], "/"), strings.Count(plan.deleteDirs[j], "/")
+		if di != dj {
+			return di > dj
+		}
+		return plan.deleteDirs[i] < plan.deleteDirs[j]
+	})
+	return plan
+}
+
+// parseSHA256SumList parses sha256sum output into a map of path to hash.
+// A leading "./" is dropped from paths.
+func parseSHA256SumList(output string) map[string]string {
+	sums := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		sum, path, ok := strings.Cut(line, "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			continue
+		}
+		sums[strings.TrimPrefix(path, "./")] = sum
+	}
+	return sums
+}
+
+// nulList joins paths for xargs -0.
+func nulList(paths []string) io.Reader {
+	var buf bytes.Buffer
+	for _, path := range paths {
+		buf.WriteString(path)
+		buf.WriteByte(0)
+	}
+	return &buf
+}
+
+// SyncSource brings the working directory in line with the source directory
+// and only transfers what changed since the last sync. On a fresh server
+// everything is sent.
+func (b *Builder) SyncSource(ctx context.Context, sourceDir string, matcher *excludeMatcher) error {
+	b.setPhase(logPhaseStaging)
+
+	local, err := buildSyncManifest(ctx, sourceDir, matcher)
+	if err != nil {
+		return fmt.Errorf("build local manifest: %w", err)
+	}
+	previous, err := b.fetchSyncManifest(ctx)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(local)+len(previous))
+	for path, entry := range local {
+		if entry.Type == syncEntryFile {
+			paths = append(paths, path)
+		}
+	}
+	for path, entry := range previous {
+		if _, ok := local[path]; !ok && entry.Type == syncEntryFile {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	hashCommand := fmt.Sprintf("mkdir -p %s && cd %s && (xargs -0 -r sha256sum -- 2>/dev/null || true)", shellQuote(b.workDir), shellQuote(b.workDir))
+	b.appendLog(fmt.Sprintf("%s %s", commandLogPrefix, hashCommand))
+	stdout, stderr, err := b.ssh.RunWithInput(ctx, hashCommand, nulList(paths))
+	if stderr != "" {
+		b.appendLog(stderr)
+	}
+	if err != nil {
+		return fmt.Errorf("hash remote files: %w", err)
+	}
+
+	plan := planSync(local, previous, parseSHA256SumList(stdout))
+	slog.Info("source sync plan",
+		"upload", len(plan.upload),
+		"upload_size", formatBytes(plan.uploadBytes),
+		"unchanged", plan.unchanged,
+		"delete", len(plan.deleteFiles)+len(plan.deleteDirs))
+
+	if len(plan.deleteFiles) > 0 || len(plan.deleteDirs) > 0 {
+		deleteCommand := fmt.Sprintf("cd %s && xargs -0 -r rm -f --", shellQuote(b.workDir))
+		if err := b.runCommandWithInput(ctx, deleteCommand, nulList(plan.deleteFiles)); err != nil {
+			return fmt.Errorf("delete removed files: %w", err)
+		}
+		rmdirCommand := fmt.Sprintf("cd %s && xargs -0 -r rmdir --ignore-fail-on-non-empty --", shellQuote(b.workDir))
+		if err := b.runCommandWithInput(ctx, rmdirCommand, nulList(plan.deleteDirs)); err != nil {
+			return fmt.Errorf("delete removed directories: %w", err)
+		}
+	}
+
+	include := func(rel string, isDir bool) bool {
+		return isDir || plan.upload[rel]
+	}
+	if err := b.streamSourceTar(ctx, sourceDir, matcher, include); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(local)
+	if err != nil {
+		return fmt.Errorf("marshal sync manifest: %w", err)
+	}
+	manifestPath := b.workDir + "/" + syncManifestFile
+	if err := b.ssh.Upload(ctx, manifestPath, bytes.NewReader(data), 0o600); err != nil {
+		return fmt.Errorf("upload sync manifest: %w", err)
+	}
+	return b.runCommand(ctx, remoteScript(b.stagedSummaryCommand()))
+}
+
+// fetchSyncManifest reads the manifest of the previous sync. A missing or
+// unreadable manifest means nothing is known about the working directory.
+func (b *Builder) fetchSyncManifest(ctx context.Context) (syncManifest, error) {
+	command := fmt.Sprintf("cat %s 2>/dev/null || true", shellQuote(b.workDir+"/"+syncManifestFile))
+	stdout, _, err := b.ssh.Run(ctx, command)
+	if err != nil {
+		return nil, fmt.Errorf("fetch remote manifest: %w", err)
+	}
+	manifest := syncManifest{}
+	if strings.TrimSpace(stdout) == "" {
+		return manifest, nil
+	}
+	if err := json.Unmarshal([]byte(stdout), &manifest); err != nil {
+		slog.Warn("ignoring unreadable remote sync manifest", "error", err)
+		return syncManifest{}, nil
+	}
+	return manifest, nil
+}
+
+func (b *Builder) runCommandWithInput(ctx context.Context, command string, input io.Reader) error {
+	b.appendLog(fmt.Sprintf("%s %s", commandLogPrefix, command))
+	stdout, stderr, err := b.ssh.RunWithInput(ctx, command, input)
+	b.appendLog(stdout)
+	if stderr != "" {
+		b.appendLog(stderr)
+	}
+	if err != nil {
+		return fmt.Errorf("remote command failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package lineage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildSyncManifest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "device", ".git"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "device", "BoardConfig.mk"), []byte("hello"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "device", ".git", "HEAD"), []byte("ref"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Symlink("device/BoardConfig.mk", filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	manifest, err := buildSyncManifest(context.Background(), dir, newExcludeMatcher([]string{".git/"}))
+	if err != nil {
+		t.Fatalf("buildSyncManifest: %v", err)
+	}
+	want := syncManifest{
+		"device": {Type: syncEntryDir, Mode: 0o755},
+		"device/BoardConfig.mk": {
+			Type:   syncEntryFile,
+			Mode:   0o644,
+			SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			Size:   5,
+		},
+		"link": {Type: syncEntrySymlink, Link: "device/BoardConfig.mk"},
+	}
+	if !reflect.DeepEqual(manifest, want) {
+		t.Errorf("unexpected manifest:\n got %+v\nwant %+v", manifest, want)
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	t.Parallel()
+
+	previous := syncManifest{
+		"a":         {Type: syncEntryDir, Mode: 0o755},
+		"a/b":       {Type: syncEntryDir, Mode: 0o755},
+		"a/b/old":   {Type: syncEntryFile, Mode: 0o644, SHA256: "old"},
+		"same":      {Type: syncEntryFile, Mode: 0o644, SHA256: "same"},
+		"chmod":     {Type: syncEntryFile, Mode: 0o644, SHA256: "chmod"},
+		"link":      {Type: syncEntrySymlink, Link: "same"},
+		"retargets": {Type: syncEntrySymlink, Link: "same"},
+	}
+	local := syncManifest{
+		"same":      {Type: syncEntryFile, Mode: 0o644, SHA256: "same", Size: 1},
+		"chmod":     {Type: syncEntryFile, Mode: 0o755, SHA256: "chmod", Size: 2},
+		"changed":   {Type: syncEntryFile, Mode: 0o644, SHA256: "new", Size: 4},
+		"link":      {Type: syncEntrySymlink, Link: "same"},
+		"retargets": {Type: syncEntrySymlink, Link: "changed"},
+	}
+	remote := map[string]string{
+		"same":    "same",
+		"chmod":   "chmod",
+		"changed": "stale",
+		"a/b/old": "old",
+	}
+
+	plan := planSync(local, previous, remote)
+
+	wantUpload := map[string]bool{"chmod": true, "changed": true, "retargets": true}
+	if !reflect.DeepEqual(plan.upload, wantUpload) {
+		t.Errorf("upload = %v, want %v", plan.upload, wantUpload)
+	}
+	if plan.uploadBytes != 6 {
+		t.Errorf("uploadBytes = %d, want 6", plan.uploadBytes)
+	}
+	if plan.unchanged != 2 {
+		t.Errorf("unchanged = %d, want 2", plan.unchanged)
+	}
+	if want := []string{"a/b/old"}; !reflect.DeepEqual(plan.deleteFiles, want) {
+		t.Errorf("deleteFiles = %v, want %v", plan.deleteFiles, want)
+	}
+	if want := []string{"a/b", "a"}; !reflect.DeepEqual(plan.deleteDirs, want) {
+		t.Errorf("deleteDirs = %v, want %v", plan.deleteDirs, want)
+	}
+}
+
+func TestPlanSyncWithoutPreviousManifest(t *testing.T) {
+	t.Parallel()
+
+	local := syncManifest{
+		"kept":     {Type: syncEntryFile, Mode: 0o644, SHA256: "kept"},
+		"uploaded": {Type: syncEntryFile, Mode: 0o644, SHA256: "new"},
+	}
+	plan := planSync(local, syncManifest{}, map[string]string{"kept": "kept"})
+	if len(plan.upload) != 1 || !plan.upload["uploaded"] {
+		t.Errorf("expected only the unknown file to be uploaded, got %v", plan.upload)
+	}
+	if len(plan.deleteFiles) != 0 || len(plan.deleteDirs) != 0 {
+		t.Errorf("expected nothing to be deleted without a previous manifest")
+	}
+}
+
+func TestParseSHA256SumList(t *testing.T) {
+	t.Parallel()
+
+	sum := strings.Repeat("a", 64)
+	output := sum + "  ./dir/file name\n" + sum + "  top\nsha256sum: missing: No such file or directory\n"
+	sums := parseSHA256SumList(output)
+	want := map[string]string{"dir/file name": sum, "top": sum}
+	if !reflect.DeepEqual(sums, want) {
+		t.Errorf("parseSHA256SumList = %v, want %v", sums, want)
+	}
+}
+
+func TestServerStateKeepsKeyOnlyWhenAsked(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	server := &HetznerServer{ID: 7, Name: "lineage", IP: "192.0.2.1", SSHPort: 22, SSHKey: []byte("PRIVATE KEY")}
+
+	path := filepath.Join(dir, "state.json")
+	if err := SaveServerState(path, server, false); err != nil {
+		t.Fatalf("SaveServerState: %v", err)
+	}
+	state, err := LoadServerState(path)
+	if err != nil {
+		t.Fatalf("LoadServerState: %v", err)
+	}
+	if state.SSHPrivateKey != "" {
+		t.Errorf("expected no private key without reuse")
+	}
+
+	if err := SaveServerState(path, server, true); err != nil {
+		t.Fatalf("SaveServerState: %v", err)
+	}
+	state, err = LoadServerState(path)
+	if err != nil {
+		t.Fatalf("LoadServerState: %v", err)
+	}
+	if state.SSHPrivateKey != "PRIVATE KEY" || state.ServerID != 7 {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
@@ -41,7 +41,18 @@ func NewSSHClient(addr, user string, privateKey []byte, timeout time.Duration) (
 }
 
 func (c *SSHClient) Run(ctx context.Context, command string) (string, string, error) {
-	log.Printf("%s %s", commandLogPrefix, command)
+	return c.run(ctx, command, nil)
+}
+
+// RunWithInput runs command with input as its stdin. The bytes sent count as
+// an upload.
+func (c *SSHClient) RunWithInput(ctx context.Context, command string, input io.Reader) (string, string, error) {
+	return c.run(ctx, command, input)
+}
+
+func (c *SSHClient) run(ctx context.Context, command string, input io.Reader) (string, string, error) {
+	slog.Info("running remote command", "command", command)
+	start := time.Now()
 	client, err := c.dial()
 	if err != nil {
 		return "", "", err
@@ -63,6 +74,11 @@ func (c *SSHClient) Run(ctx context.Context, command string) (string, string, er
 
 	session.Stdout = stdoutWriter
 	session.Stderr = stderrWriter
+	var counter *countingReader
+	if input != nil {
+		counter = &countingReader{reader: input}
+		session.Stdin = counter
+	}
 
 	done := make(chan error, 1)
 	go func() { done <- session.Run(command) }()
@@ -76,10 +92,14 @@ func (c *SSHClient) Run(ctx context.Context, command string) (string, string, er
 		stdoutWriter.flush()
 		stderrWriter.flush()
 		if out := strings.TrimSpace(stdoutBuf.String()); out != "" {
-			log.Printf("[SSH][stdout]\n%s", out)
+			slog.Debug("[SSH][stdout]", "command", command, "stdout", out)
 		}
 		if errOut := strings.TrimSpace(stderrBuf.String()); errOut != "" {
-			log.Printf("[SSH][stderr]\n%s", errOut)
+			slog.Debug("[SSH][stderr]", "command", command, "stderr", errOut)
+		}
+		slog.Info("remote command finished", "command", command, "duration", time.Since(start), "success", err == nil)
+		if counter != nil {
+			observeTransfer(transferUpload, counter.n, time.Since(start))
 		}
 		if err != nil {
 			return stdoutBuf.String(), stderrBuf.String(), fmt.Errorf("run command: %w", err)
@@ -101,12 +121,14 @@ func (c *SSHClient) Upload(ctx context.Context, remotePath string, content io.Re
 	}
 	defer session.Close()
 
-	session.Stdin = content
+	counter := &countingReader{reader: content}
+	session.Stdin = counter
 	quotedPath := shellQuote(remotePath)
 	chmodCommand := fmt.Sprintf("chmod %#o %s", mode.Perm(), quotedPath)
 	writeCommand := fmt.Sprintf("cat > %s && %s", quotedPath, chmodCommand)
 	command := fmt.Sprintf("sh -c %s", shellQuote(writeCommand))
 
+	start := time.Now()
 	done := make(chan error, 1)
 	go func() { done <- session.Run(command) }()
 
@@ -118,6 +140,7 @@ func (c *SSHClient) Upload(ctx context.Context, remotePath string, content io.Re
 		if err != nil {
 			return fmt.Errorf("upload file: %w", err)
 		}
+		observeTransfer(transferUpload, counter.n, time.Since(start))
 		return nil
 	}
 }
@@ -142,10 +165,12 @@ func (c *SSHClient) Download(ctx context.Context, remotePath, localPath string)
 	defer session.Close()
 
 	var stderr bytes.Buffer
-	session.Stdout = file
+	counter := &countingWriter{writer: file}
+	session.Stdout = counter
 	session.Stderr = &stderr
 
 	command := fmt.Sprintf("cat %s", shellQuote(remotePath))
+	start := time.Now()
 	done := make(chan error, 1)
 	go func() { done <- session.Run(command) }()
 
@@ -157,6 +182,7 @@ func (c *SSHClient) Download(ctx context.Context, remotePath, localPath string)
 		if err != nil {
 			return fmt.Errorf("download file: %w: %s", err, strings.TrimSpace(stderr.String()))
 		}
+		observeTransfer(transferDownload, counter.n, time.Since(start))
 		return nil
 	}
 }
@@ -218,6 +244,30 @@ func GenerateEphemeralSSHKey() (privatePEM []byte, publicKey string, err error)
 	return privatePEM, publicKey, nil
 }
 
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
 // lineWriter 是一个 io.Writer，它在遇到换行符时实时输出到 out，同时保留所有内容到 buf
 type lineWriter struct {
 	buf    *bytes.Buffer